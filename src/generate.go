@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/generator"
+)
+
+func generate(args []string) error {
+	config := generator.DefaultConfig()
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	database := flags.String("database", "", "connection string of the database to populate, required so that the Central database is never overwritten")
+	reset := flags.Bool("reset", false, "drop the existing tables of the generated schema before creating them")
+	flags.IntVar(&config.Clusters, "clusters", config.Clusters, "number of clusters")
+	flags.IntVar(&config.Namespaces, "namespaces", config.Namespaces, "total number of namespaces")
+	flags.Float64Var(&config.NamespaceSkew, "namespace-skew", config.NamespaceSkew, "Zipf exponent of the namespaces per cluster, 0 for an even spread")
+	flags.IntVar(&config.Deployments, "deployments", config.Deployments, "total number of deployments")
+	flags.Float64Var(&config.DeploymentSkew, "deployment-skew", config.DeploymentSkew, "Zipf exponent of the deployments per namespace")
+	flags.IntVar(&config.ContainersPerDeployment, "containers", config.ContainersPerDeployment, "mean number of containers per deployment")
+	flags.IntVar(&config.Images, "images", config.Images, "number of images")
+	flags.Float64Var(&config.ImageSkew, "image-skew", config.ImageSkew, "Zipf exponent of the image references of the containers")
+	flags.IntVar(&config.Alerts, "alerts", config.Alerts, "total number of alerts")
+	flags.Float64Var(&config.AlertSkew, "alert-skew", config.AlertSkew, "Zipf exponent of the alerts per deployment")
+	flags.Int64Var(&config.Seed, "seed", config.Seed, "seed of the random generator, the same seed generates the same data")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if *database == "" {
+		return errors.New("the -database flag is required, generate does not populate the Central database")
+	}
+	ctx := context.Background()
+	pool, err := db.Connect(ctx, *database)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	dataset := generator.Generate(config, time.Now())
+	fmt.Printf(
+		"Generated %d clusters, %d namespaces, %d deployments, %d images and %d alerts\n",
+		len(dataset.Clusters),
+		len(dataset.Namespaces),
+		len(dataset.Deployments),
+		len(dataset.Images),
+		len(dataset.Alerts),
+	)
+	if err = generator.Load(ctx, pool, dataset, *reset); err != nil {
+		return err
+	}
+	fmt.Println("Dataset loaded")
+	return nil
+}
@@ -2,26 +2,65 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/cache"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/catalog"
 	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/htmlreport"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/metrics"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/params"
 	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/report"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/runner"
 	"github.com/rhybrillou/sacsqlperf/src/pkg/scope"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/server"
 )
 
 var (
-	scopeSizes = []int{10, 20, 50, 100, 200, 500, 1000, 2000}
+	genericPlans       = flag.Bool("generic-plans", false, "analyze custom versus generic plans of the prepared SAC-injected statements")
+	executions         = flag.Int("executions", 3, "number of executions of each query, the first one is reported as cold")
+	cacheMode          = flag.String("cache-mode", cache.ModeNone, "buffer cache preparation before the first execution of each query: none, prewarm or evict")
+	outputFile         = flag.String("output", "/tmp/sacsqlperf-results.json", "path of the JSON results file")
+	htmlOutputFile     = flag.String("html-output", "", "path of the HTML report to write after the run, none if empty")
+	serveAddress       = flag.String("serve", "", "address to serve progress, results and metrics over HTTP on, e.g. :8080, disabled if empty")
+	serveIdleTimeout   = flag.Duration("serve-idle-timeout", time.Hour, "shut the HTTP server down after the run when no request was received for this long")
+	catalogFile        = flag.String("catalog", "", "path of a JSON query catalog replacing the built-in queries")
+	queryNames         = flag.String("queries", "", "comma separated names of the queries to profile, all if neither queries nor tags are given")
+	queryTags          = flag.String("tags", "", "comma separated tags of the queries to profile")
+	rlsMode            = flag.Bool("rls", false, "also profile the unmodified queries with the scope enforced by row-level security policies")
+	verifyMode         = flag.Bool("verify", false, "compare the result sets of the injection strategies of each scope")
+	verifyReference    = flag.String("verify-reference", report.InjectionOrTree, "injection strategy the result sets are compared with: or-tree, exists or rls")
+	compareCasts       = flag.Bool("compare-casts", false, "also profile the SAC-injected statements with typed bind values rendered without their casts")
+	compareLiterals    = flag.Bool("compare-literals", false, "also profile the SAC-injected statements with their bind values inlined as literals")
+	databaseURL        = flag.String("database", "", "connection string of the database to profile, the Central database if empty")
+	scopeSizeSpec      = flag.String("scope-sizes", "log,50%,all", "comma separated scope sizes: namespace counts, percentages of the namespaces (50%), all, or a logarithmic 1-2-5 sweep (log from 10, log:N from N)")
+	statementTimeout   = flag.Duration("statement-timeout", 0, "cancel the profiled statements running longer, recording them as timed out; 0 for the statement_timeout of the server")
+	queryBudget        = flag.Duration("query-budget", 0, "time allotted to each query, its remaining scopes being recorded as skipped; 0 for no limit")
+	runBudget          = flag.Duration("run-budget", 0, "time allotted to the run, which then stops and writes the results profiled so far; 0 for no limit")
+	preparedExecutions = flag.Int("prepared-executions", 10, "number of executions of each prepared statement for the generic plan analysis")
+)
 
+var (
 	testedQueries = []*query.Query{
 		{
-			Statement: "select",
-			StatementTargets: []string{
-				"distinct(images.Id) as Image_Sha",
-				"images.RiskScore as image_risk_score",
+			Name:        "images-by-risk",
+			Description: "Images with the highest risk score",
+			Tags:        []string{"images", "vuln-mgmt", "dashboard"},
+			Origin:      "Dashboard: images at most risk",
+			Statement:   "select",
+			StatementTargets: []query.Target{
+				{Expression: "distinct(images.Id)", Alias: "Image_Sha"},
+				{Column: &query.QualifiedColumn{TableName: "images", ColumnName: "RiskScore"}, Alias: "image_risk_score"},
 			},
 			TargetTables: []string{"images"},
 			InnerJoins: []query.InnerJoin{
@@ -44,35 +83,84 @@ var (
 			ScopeTable:           "deployments",
 			ScopeClusterColumn:   "ClusterId",
 			ScopeNamespaceColumn: "Namespace",
-		}, /*
-			{
-				Statement: "select",
-				StatementTargets: []string{
-					"count(*)",
+			ScopeClusterType:     "uuid",
+			ScopeNamespaceType:   "varchar",
+		},
+		{
+			Name:        "images-count",
+			Description: "Number of images deployed in the scope",
+			Tags:        []string{"images", "vuln-mgmt"},
+			Origin:      "/v1/images/count",
+			Statement:   "select",
+			StatementTargets: []query.Target{
+				query.Raw("count(*)"),
+			},
+			TargetTables:         []string{"images"},
+			InnerJoins:           []query.InnerJoin{},
+			ScopeLevel:           "namespace",
+			ScopeTable:           "deployments",
+			ScopeClusterColumn:   "ClusterId",
+			ScopeNamespaceColumn: "Namespace",
+			ScopeClusterType:     "uuid",
+			ScopeNamespaceType:   "varchar",
+			ScopeJoins: []query.InnerJoin{
+				{
+					Left:  query.QualifiedColumn{TableName: "images", ColumnName: "Id"},
+					Right: query.QualifiedColumn{TableName: "deployments_containers", ColumnName: "Image_Id"},
+				},
+				{
+					Left:  query.QualifiedColumn{TableName: "deployments_containers", ColumnName: "deployments_Id"},
+					Right: query.QualifiedColumn{TableName: "deployments", ColumnName: "Id"},
 				},
-				TargetTables: []string{"alerts"},
-				InnerJoins:   []query.InnerJoin{},
-				WhereClause: &query.WcAnd{
-					Operands: []query.WhereClausePart{
-						&query.QualifiedColumn{TableName: "alerts", ColumnName: "Policy_Severity", Value: 3},
-						&query.WcOr{
-							Operands: []query.WhereClausePart{
-								&query.QualifiedColumn{TableName: "alerts", ColumnName: "State", Value: 0},
-								&query.QualifiedColumn{TableName: "alerts", ColumnName: "State", Value: 3},
-							},
+			},
+		},
+		{
+			Name:        "active-alerts-count",
+			Description: "Number of active or attempted alerts of a given policy severity",
+			Tags:        []string{"alerts", "dashboard"},
+			Origin:      "/v1/alerts/summary/counts",
+			Statement:   "select",
+			StatementTargets: []query.Target{
+				query.Raw("count(*)"),
+			},
+			TargetTables: []string{"alerts"},
+			InnerJoins:   []query.InnerJoin{},
+			WhereClause: &query.WcAnd{
+				Operands: []query.WhereClausePart{
+					&query.QualifiedColumn{TableName: "alerts", ColumnName: "Policy_Severity", Placeholder: "severity"},
+					&query.WcOr{
+						Operands: []query.WhereClausePart{
+							&query.QualifiedColumn{TableName: "alerts", ColumnName: "State", Value: 0},
+							&query.QualifiedColumn{TableName: "alerts", ColumnName: "State", Value: 3},
 						},
 					},
 				},
-				ScopeLevel:           "namespace",
-				ScopeTable:           "alerts",
-				ScopeClusterColumn:   "ClusterId",
-				ScopeNamespaceColumn: "Namespace",
-			}, */
+			},
+			Parameters: []query.Parameter{
+				{
+					Name: "severity",
+					Generator: query.Generator{
+						Kind:   query.GeneratorList,
+						Values: []interface{}{1, 2, 3, 4},
+					},
+				},
+			},
+			ScopeLevel:           "namespace",
+			ScopeTable:           "alerts",
+			ScopeClusterColumn:   "ClusterId",
+			ScopeNamespaceColumn: "Namespace",
+			ScopeClusterType:     "uuid",
+			ScopeNamespaceType:   "varchar",
+		},
 		{
-			Statement: "select",
-			StatementTargets: []string{
-				"policy_severity",
-				"count(*)",
+			Name:        "alerts-by-severity",
+			Description: "Number of active or attempted alerts by policy severity",
+			Tags:        []string{"alerts", "dashboard"},
+			Origin:      "Dashboard: policy violations by severity",
+			Statement:   "select",
+			StatementTargets: []query.Target{
+				{Column: &query.QualifiedColumn{ColumnName: "policy_severity"}},
+				query.Raw("count(*)"),
 			},
 			TargetTables: []string{"alerts"},
 			InnerJoins:   []query.InnerJoin{},
@@ -93,189 +181,271 @@ var (
 			ScopeTable:           "alerts",
 			ScopeClusterColumn:   "ClusterId",
 			ScopeNamespaceColumn: "Namespace",
+			ScopeClusterType:     "uuid",
+			ScopeNamespaceType:   "varchar",
 		},
 	}
 )
 
 func main() {
-	// Ensure the logs are available for a while after the execution completed.
-	defer done()
-	ctx := context.Background()
-	_ = ctx
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "html":
+			exitOnError("rendering HTML report", renderHTML(os.Args[2:]))
+			return
+		case "generate":
+			exitOnError("generating dataset", generate(os.Args[2:]))
+			return
+		case "dump":
+			exitOnError("dumping data", dump(os.Args[2:]))
+			return
+		case "load":
+			exitOnError("loading data", load(os.Args[2:]))
+			return
+		}
+	}
+	run()
+}
+
+func exitOnError(action string, err error) {
+	if err != nil {
+		fmt.Printf("Error %s: %v\n", action, err)
+		os.Exit(1)
+	}
+}
+
+func renderHTML(args []string) error {
+	flags := flag.NewFlagSet("html", flag.ExitOnError)
+	input := flags.String("input", "/tmp/sacsqlperf-results.json", "path of the JSON results file to read")
+	output := flags.String("output", "/tmp/sacsqlperf-report.html", "path of the HTML report to write")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	results, err := report.ReadFile(*input)
+	if err != nil {
+		return err
+	}
+	if err = writeHTML(results, *output); err != nil {
+		return err
+	}
+	fmt.Println("HTML report written to", *output)
+	return nil
+}
+
+func writeHTML(results *report.Report, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "Could not create %q", path)
+	}
+	defer f.Close()
+	return htmlreport.Render(f, results)
+}
+
+// resolveScopeSizes resolves the scope sizes against the discovered
+// namespaces, and logs the sweep.
+func resolveScopeSizes(sizes []scope.Size, namespacesByCluster map[string][]string) []int {
+	total := 0
+	for _, namespaces := range namespacesByCluster {
+		total += len(namespaces)
+	}
+	resolved := scope.ResolveSizes(sizes, total)
+	names := make([]string, 0, len(sizes))
+	for _, size := range sizes {
+		names = append(names, size.String())
+	}
+	fmt.Printf("Scope sizes %s for %d namespaces in %d clusters: %v\n", strings.Join(names, ","), total, len(namespacesByCluster), resolved)
+	return resolved
+}
+
+func run() {
+	var resultServer *server.Server
+	// SIGINT and SIGTERM cancel the in-flight statements, the results
+	// profiled until then are written.
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Ensure the logs and results are available for a while after the execution completed.
+	defer func() { done(signalCtx, resultServer) }()
+	flag.Parse()
+	ctx := signalCtx
+	if *runBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, *runBudget, runner.ErrRunBudget)
+		defer cancel()
+	}
+	if !cache.ValidMode(*cacheMode) {
+		fmt.Printf("Invalid cache mode %q\n", *cacheMode)
+		return
+	}
+	if *executions < 1 {
+		fmt.Printf("Invalid number of executions %d\n", *executions)
+		return
+	}
+	if *verifyMode && !slices.Contains([]string{report.InjectionOrTree, report.InjectionExists, report.InjectionRLS}, *verifyReference) {
+		fmt.Printf("Invalid verification reference %q\n", *verifyReference)
+		return
+	}
+	// Enabling row-level security locks the scope tables, which would block
+	// Central.
+	if *rlsMode && *databaseURL == "" {
+		fmt.Println("The -rls flag requires -database, row-level security is not set up on the Central database")
+		return
+	}
+	if *verifyMode && *verifyReference == report.InjectionRLS && !*rlsMode {
+		fmt.Println("The rls verification reference requires -rls")
+		return
+	}
+	sizes, err := scope.ParseSizes(*scopeSizeSpec)
+	if err != nil {
+		fmt.Printf("Invalid scope sizes: %v\n", err)
+		return
+	}
+	queries, err := selectQueries()
+	if err != nil {
+		fmt.Printf("Error selecting queries: %v\n", err)
+		return
+	}
 	fmt.Println("Starting SQL performance tests")
 
-	db, err := db.GetDBConn(ctx)
+	pool, err := connect(ctx, *databaseURL)
 	if err != nil {
 		fmt.Printf("Error getting DB connection: %v\n", err)
 		return
 	}
-	defer db.Close()
-	dbRow := db.QueryRow(ctx, "select current_database()")
-	var dbName string
-	err = dbRow.Scan(&dbName)
+	defer pool.Close()
+	queries, err = params.NewExpander(pool, time.Now()).ExpandAll(ctx, queries)
+	if err != nil {
+		fmt.Printf("Error expanding query templates: %v\n", err)
+		return
+	}
+	queryRunner := runner.New(pool, runner.Options{
+		Executions:         *executions,
+		CacheMode:          *cacheMode,
+		GenericPlans:       *genericPlans,
+		PreparedExecutions: *preparedExecutions,
+		RLS:                *rlsMode,
+		Verify:             *verifyMode,
+		VerifyReference:    *verifyReference,
+		CompareCasts:       *compareCasts,
+		CompareLiterals:    *compareLiterals,
+		StatementTimeout:   *statementTimeout,
+		QueryBudget:        *queryBudget,
+	})
+	dbName, err := queryRunner.DatabaseName(ctx)
+	if err != nil {
+		fmt.Printf("Error getting database name: %v\n", err)
+		return
+	}
 	fmt.Println("connected to", dbName)
 	fmt.Println("Querying namespaces")
-	const namespaceCountStatement = "select count(*) from namespaces"
-	fmt.Println("Running", namespaceCountStatement)
-	row := db.QueryRow(ctx, namespaceCountStatement)
-	var namespaceCount int
-	err = row.Scan(&namespaceCount)
-	fmt.Printf("Found %d namespaces\n", namespaceCount)
-	rows, err := db.Query(ctx, "select clusterid, name from namespaces")
-	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+	namespacesByCluster, err := queryRunner.DiscoverNamespaces(ctx)
+	if err != nil {
 		fmt.Printf("Error querying namespaces: %v\n", err)
 		return
 	}
 	fmt.Println("Namespace query complete")
-	defer rows.Close()
-	c := 0
-	namespacesByCluster := make(map[string][]string, 0)
-	for rows.Next() {
-		c++
-		// fmt.Print(".")
-		var clusterID string
-		var namespaceName string
-		err = rows.Scan(&clusterID, &namespaceName)
-		if err != nil {
-			continue
-		}
-		if _, found := namespacesByCluster[clusterID]; !found {
-			namespacesByCluster[clusterID] = make([]string, 0, namespaceCount)
-		}
-		namespacesByCluster[clusterID] = append(namespacesByCluster[clusterID], namespaceName)
+	scopeSizes := resolveScopeSizes(sizes, namespacesByCluster)
+	selections := []runner.Selection{
+		{Name: report.SelectionOrdered, Scopes: scope.SelectNamespacesOrdered(namespacesByCluster, scopeSizes)},
+		{Name: report.SelectionRandom, Scopes: scope.SelectNamespacesRandom(namespacesByCluster, scopeSizes)},
 	}
-	fmt.Printf("Selected %d namespaces\n", c)
-	for clusterID, namespaces := range namespacesByCluster {
-		fmt.Printf("Found %d namespaces for cluster %q\n", len(namespaces), clusterID)
+	fmt.Println("Validating statements")
+	if err = queryRunner.Validate(ctx, queries, selections); err != nil {
+		fmt.Printf("Error validating queries: %v\n", err)
+		return
 	}
-	orderedScopeNamespaces := scope.SelectNamespacesOrdered(namespacesByCluster, scopeSizes)
-	pseudoRandomScopeNamespaces := scope.SelectNamespacesRandom(namespacesByCluster, scopeSizes)
-	_ = orderedScopeNamespaces
-	_ = pseudoRandomScopeNamespaces
 
-	for ix, q := range testedQueries {
-		_ = ix
-		fmt.Println("index", ix)
-		stmt, _ := q.ForExecution()
-		fmt.Println(stmt)
-		err = explain(ctx, db, q)
+	results := report.New(dbName)
+	results.Queries = queries
+	results.SetPlanned(queryRunner.PlannedEntries(queries, selections))
+	registry := metrics.NewRegistry()
+	record := func(entry *report.Entry) {
+		results.Add(entry)
+		registry.Observe(entry)
+	}
+	if *serveAddress != "" {
+		resultServer, err = server.Start(*serveAddress, results, registry, *serveIdleTimeout)
 		if err != nil {
-			fmt.Printf("Error querying for execution plan: %v\n", err)
+			fmt.Printf("Error starting HTTP server: %v\n", err)
+			return
 		}
-		for _, scope := range orderedScopeNamespaces {
-			fmt.Printf("Getting plan for %d ordered namespaces\n", len(scope))
-			sq := injectSACFilter(q, scope)
-			err = explain(ctx, db, sq)
-			if err != nil {
-				fmt.Printf("Error querying for execution plan: %v\n", err)
-			}
+		fmt.Println("Serving progress and results on", resultServer.Addr())
+	}
+	results.SetTables(queryRunner.CaptureTableStats(ctx, queries))
+	// The entries profiled before a failure or an interruption are written
+	// all the same.
+	err = queryRunner.Run(ctx, queries, selections, record)
+	if err != nil {
+		fmt.Printf("Error running queries: %v\n", err)
+	}
+	results.Finish()
+	interrupted := results.Interrupted()
+	if len(interrupted) > 0 {
+		fmt.Printf("Interruptions: %d entries timed out, were skipped or were cancelled\n", len(interrupted))
+		for _, entry := range interrupted {
+			fmt.Printf("%s: query %q, %s %s, %d namespaces: %s\n", entry.Status, entry.Query, entry.Selection, entry.Injection, entry.ScopeSize, entry.Error)
 		}
-		for _, scope := range pseudoRandomScopeNamespaces {
-			fmt.Printf("Getting plan for %d random namespaces\n", len(scope))
-			sq := injectSACFilter(q, scope)
-			err = explain(ctx, db, sq)
-			if err != nil {
-				fmt.Printf("Error querying for execution plan: %v\n", err)
-			}
+	}
+	if *verifyMode {
+		mismatches := results.Mismatches()
+		fmt.Printf("Verification: %d result sets differ from the %s ones\n", len(mismatches), *verifyReference)
+		for _, entry := range mismatches {
+			fmt.Printf("Mismatch: query %q, %s %s, %d namespaces\n", entry.Query, entry.Selection, entry.Injection, entry.ScopeSize)
 		}
 	}
-}
-
-func explain(ctx context.Context, db *pgxpool.Pool, request *query.Query) error {
-	stmt, bindValues := request.ForExecution()
-	explainRows, err := db.Query(ctx, fmt.Sprintf("explain (verbose, analyze, buffers, settings) %s", stmt), bindValues...)
+	err = results.WriteFile(*outputFile)
 	if err != nil {
-		return err
+		fmt.Printf("Error writing results: %v\n", err)
+		return
 	}
-	defer explainRows.Close()
-	for explainRows.Next() {
-		var explainResult string
-		err = explainRows.Scan(&explainResult)
+	fmt.Println("Results written to", *outputFile)
+	if *htmlOutputFile != "" {
+		err = writeHTML(results, *htmlOutputFile)
 		if err != nil {
-			return err
+			fmt.Printf("Error writing HTML report: %v\n", err)
+			return
 		}
-		fmt.Println(explainResult)
+		fmt.Println("HTML report written to", *htmlOutputFile)
 	}
-	return nil
 }
 
-func done() {
-	fmt.Println("Sleeping an hour")
-	time.Sleep(time.Hour)
+func connect(ctx context.Context, connString string) (*pgxpool.Pool, error) {
+	if connString != "" {
+		return db.Connect(ctx, connString)
+	}
+	return db.GetDBConn(ctx)
 }
 
-func injectSACFilter(request *query.Query, scope []scope.ScopeNamespace) *query.Query {
-	if request == nil {
-		return nil
-	}
-	if len(scope) <= 0 {
-		return request
-	}
-	if request.ScopeLevel != "cluster" && request.ScopeLevel != "namespace" {
-		return request
-	}
-	namespacesByCluster := make(map[string][]string, 0)
-	for _, ns := range scope {
-		namespacesByCluster[ns.ClusterID] = append(namespacesByCluster[ns.ClusterID], ns.NamespaceName)
-	}
-	whereClusters := make([]query.WhereClausePart, 0, len(namespacesByCluster))
-	for clusterID, namespaces := range namespacesByCluster {
-		clusterColumnPart := &query.QualifiedColumn{
-			TableName:  request.ScopeTable,
-			ColumnName: request.ScopeClusterColumn,
-			Value:      clusterID,
-		}
-		switch request.ScopeLevel {
-		case "cluster":
-			whereClusters = append(whereClusters, clusterColumnPart)
-		case "namespace":
-			whereClusterNamespaces := make([]query.WhereClausePart, 0, len(namespaces))
-			for _, ns := range namespaces {
-				namespaceColumnPart := &query.QualifiedColumn{
-					TableName:  request.ScopeTable,
-					ColumnName: request.ScopeNamespaceColumn,
-					Value:      ns,
-				}
-				whereClusterNamespaces = append(whereClusterNamespaces, namespaceColumnPart)
-			}
-			whereClusters = append(whereClusters, &query.WcAnd{
-				Operands: []query.WhereClausePart{
-					clusterColumnPart,
-					&query.WcOr{
-						Operands: whereClusterNamespaces,
-					},
-				},
-			})
-		default:
-			continue
+func selectQueries() ([]*query.Query, error) {
+	queries := testedQueries
+	if *catalogFile != "" {
+		var err error
+		queries, err = catalog.Load(*catalogFile)
+		if err != nil {
+			return nil, err
 		}
+	} else if err := catalog.Validate(queries); err != nil {
+		return nil, err
 	}
-	result := &query.Query{
-		Statement:            request.Statement,
-		StatementTargets:     request.StatementTargets,
-		TargetTables:         request.TargetTables,
-		InnerJoins:           request.InnerJoins,
-		OrderBy:              request.OrderBy,
-		GroupBy:              request.GroupBy,
-		QueryPagination:      request.QueryPagination,
-		ScopeLevel:           request.ScopeLevel,
-		ScopeTable:           request.ScopeTable,
-		ScopeClusterColumn:   request.ScopeClusterColumn,
-		ScopeNamespaceColumn: request.ScopeNamespaceColumn,
-	}
-	if request.WhereClause != nil {
-		result.WhereClause = &query.WcAnd{
-			Operands: []query.WhereClausePart{
-				&query.WcOr{
-					Operands: whereClusters,
-				},
-				request.WhereClause,
-			},
+	return catalog.Select(queries, catalog.ParseList(*queryNames), catalog.ParseList(*queryTags))
+}
+
+func done(ctx context.Context, resultServer *server.Server) {
+	if resultServer != nil {
+		if ctx.Err() == nil {
+			fmt.Println("Serving results on", resultServer.Addr(), "until shutdown")
 		}
-	} else {
-		result.WhereClause = &query.WcOr{
-			Operands: whereClusters,
+		err := resultServer.Wait(ctx)
+		if err != nil {
+			fmt.Printf("Error shutting down HTTP server: %v\n", err)
 		}
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	fmt.Println("Sleeping an hour")
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Hour):
 	}
-	return result
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/cache"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db/pgtest"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/params"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/report"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/runner"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/scope"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPipeline profiles the built-in queries on a local Postgres loaded
+// with the reduced Central schema, from the namespace discovery to the
+// results file.
+func TestPipeline(t *testing.T) {
+	server := pgtest.StartCentral(t)
+	pool := server.Connect(t)
+	ctx := context.Background()
+
+	queries, err := params.NewExpander(pool, time.Now()).ExpandAll(ctx, testedQueries)
+	require.NoError(t, err)
+	require.Len(t, queries, 7)
+
+	queryRunner := runner.New(pool, runner.Options{
+		Executions:         2,
+		CacheMode:          cache.ModePrewarm,
+		GenericPlans:       true,
+		PreparedExecutions: 6,
+		RLS:                true,
+		Verify:             true,
+		VerifyReference:    report.InjectionRLS,
+	})
+	dbName, err := queryRunner.DatabaseName(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "central_active", dbName)
+
+	namespacesByCluster, err := queryRunner.DiscoverNamespaces(ctx)
+	require.NoError(t, err)
+	require.Len(t, namespacesByCluster, 3)
+	for _, namespaces := range namespacesByCluster {
+		assert.Len(t, namespaces, 10)
+	}
+
+	sizes := []int{1, 5, 15}
+	selections := []runner.Selection{
+		{Name: report.SelectionOrdered, Scopes: scope.SelectNamespacesOrdered(namespacesByCluster, sizes)},
+		{Name: report.SelectionRandom, Scopes: scope.SelectNamespacesRandom(namespacesByCluster, sizes)},
+	}
+	require.NoError(t, queryRunner.Validate(ctx, queries, selections))
+	results := report.New(dbName)
+	results.Queries = queries
+	results.SetPlanned(queryRunner.PlannedEntries(queries, selections))
+	results.Tables = queryRunner.CaptureTableStats(ctx, queries)
+	require.NoError(t, queryRunner.Run(ctx, queries, selections, results.Add))
+	results.Finish()
+
+	progress := results.Progress()
+	assert.True(t, progress.Done)
+	assert.Equal(t, progress.Planned, progress.Completed)
+	require.Len(t, results.Tables, 4)
+	for _, table := range results.Tables {
+		if table.Name == "alerts" {
+			assert.Equal(t, int64(600), table.RowCount)
+		}
+	}
+	rowsByScope := make(map[string]map[string]float64)
+	for _, entry := range results.Entries {
+		assert.Empty(t, entry.Error, entry.Query)
+		assert.NotNil(t, entry.Plan, entry.Query)
+		assert.Len(t, entry.Executions, 2, entry.Query)
+		assert.NotNil(t, entry.Statements, entry.Query)
+		if entry.Selection == report.SelectionNone {
+			assert.Nil(t, entry.GenericPlan, entry.Query)
+			continue
+		}
+		assert.Contains(t, sizes, entry.ScopeSize)
+		key := fmt.Sprintf("%s %s %d", entry.Query, entry.Selection, entry.ScopeSize)
+		if rowsByScope[key] == nil {
+			rowsByScope[key] = make(map[string]float64)
+		}
+		if entry.Plan != nil {
+			rowsByScope[key][entry.Injection] = entry.Plan.Plan.ActualRows
+		}
+		require.NotNil(t, entry.GenericPlan, entry.Query)
+		assert.Len(t, entry.GenericPlan.Executions, 6)
+		require.NotNil(t, entry.Verification, entry.Query)
+		if entry.Query == "images-count" && entry.Injection == report.InjectionExists {
+			assert.True(t, entry.Verification.Match, key)
+		}
+	}
+	// The images are counted once per container running them when the
+	// scope path is joined.
+	mismatches := results.Mismatches()
+	assert.NotEmpty(t, mismatches)
+	for _, entry := range mismatches {
+		if entry.Query == "images-count" {
+			assert.Equal(t, report.InjectionOrTree, entry.Injection)
+		}
+	}
+
+	// The joins of a scope path may repeat the rows the exists subquery and
+	// the row-level security policy count once.
+	for key, rowsByInjection := range rowsByScope {
+		if exists, found := rowsByInjection[report.InjectionExists]; found {
+			assert.Len(t, rowsByInjection, 3, key)
+			assert.Equal(t, exists, rowsByInjection[report.InjectionRLS], key)
+			continue
+		}
+		assert.Len(t, rowsByInjection, 2, key)
+		assert.Equal(t, rowsByInjection[report.InjectionOrTree], rowsByInjection[report.InjectionRLS], key)
+	}
+
+	path := filepath.Join(t.TempDir(), "results.json")
+	require.NoError(t, results.WriteFile(path))
+	read, err := report.ReadFile(path)
+	require.NoError(t, err)
+	assert.Len(t, read.Entries, len(results.Entries))
+	assert.Len(t, read.Queries, len(queries))
+}
@@ -3,9 +3,65 @@ package main
 import (
 	"testing"
 
+	"github.com/rhybrillou/sacsqlperf/src/pkg/catalog"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/scope"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestMain(t *testing.T) {
-	assert.True(t, true)
+func TestBuiltInQueries(t *testing.T) {
+	require.NoError(t, catalog.Validate(testedQueries))
+	for _, q := range testedQueries {
+		assert.NoError(t, q.Validate(), q.Name)
+		assert.NotEmpty(t, q.Tags, q.Name)
+		stmt, _ := q.ForExecution()
+		assert.NotEmpty(t, stmt, q.Name)
+	}
+}
+
+func TestSelectQueries(t *testing.T) {
+	names := func(queries []*query.Query) []string {
+		result := make([]string, 0, len(queries))
+		for _, q := range queries {
+			result = append(result, q.Name)
+		}
+		return result
+	}
+	defer func(names, tags string) {
+		*queryNames = names
+		*queryTags = tags
+	}(*queryNames, *queryTags)
+
+	for name, tc := range map[string]struct {
+		names    string
+		tags     string
+		expected []string
+	}{
+		"all":       {expected: names(testedQueries)},
+		"by name":   {names: "images-count, alerts-by-severity", expected: []string{"images-count", "alerts-by-severity"}},
+		"by tag":    {tags: "alerts", expected: []string{"active-alerts-count", "alerts-by-severity"}},
+		"name, tag": {names: "images-count", tags: "dashboard", expected: []string{"images-by-risk", "images-count", "active-alerts-count", "alerts-by-severity"}},
+	} {
+		*queryNames = tc.names
+		*queryTags = tc.tags
+		queries, err := selectQueries()
+		require.NoError(t, err, name)
+		assert.ElementsMatch(t, tc.expected, names(queries), name)
+	}
+
+	*queryNames = "unknown"
+	*queryTags = ""
+	_, err := selectQueries()
+	assert.Error(t, err)
+}
+
+func TestResolveScopeSizes(t *testing.T) {
+	sizes, err := scope.ParseSizes("log,50%,all")
+	require.NoError(t, err)
+	namespacesByCluster := map[string][]string{
+		"cluster-1": make([]string, 20),
+		"cluster-2": make([]string, 10),
+	}
+	assert.Equal(t, []int{10, 15, 20, 30}, resolveScopeSizes(sizes, namespacesByCluster))
 }
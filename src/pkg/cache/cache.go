@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+)
+
+const (
+	ModeNone    = "none"
+	ModePrewarm = "prewarm"
+	ModeEvict   = "evict"
+
+	evictionTable = "sacsqlperf_eviction"
+	// Rows of a little less than 1kB fit seven to a page.
+	evictionRowsPerPage = 7
+
+	sharedBuffersStatement = "select setting::bigint from pg_settings where name = 'shared_buffers'"
+	indexesStatement       = "select indexrelid::regclass::text from pg_index where indrelid = $1::regclass"
+)
+
+func ValidMode(mode string) bool {
+	switch mode {
+	case ModeNone, ModePrewarm, ModeEvict:
+		return true
+	default:
+		return false
+	}
+}
+
+// Prewarm loads the given tables and their indexes in the shared buffers.
+func Prewarm(ctx context.Context, db db.DB, tables []string) error {
+	_, err := db.Exec(ctx, "create extension if not exists pg_prewarm")
+	if err != nil {
+		return errors.Wrap(err, "Could not create extension pg_prewarm")
+	}
+	for _, table := range tables {
+		relation := query.QuoteIdentifier(table)
+		relations, err := tableIndexes(ctx, db, relation)
+		if err != nil {
+			return err
+		}
+		relations = append(relations, relation)
+		for _, relation := range relations {
+			_, err = db.Exec(ctx, "select pg_prewarm($1::regclass)", relation)
+			if err != nil {
+				return errors.Wrapf(err, "Could not prewarm %q", relation)
+			}
+		}
+	}
+	return nil
+}
+
+func tableIndexes(ctx context.Context, db db.DB, table string) ([]string, error) {
+	rows, err := db.Query(ctx, indexesStatement, table)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not list indexes of %q", table)
+	}
+	defer rows.Close()
+	indexes := make([]string, 0)
+	for rows.Next() {
+		var index string
+		if err = rows.Scan(&index); err != nil {
+			return nil, errors.Wrapf(err, "Could not list indexes of %q", table)
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, rows.Err()
+}
+
+// Evictor replaces the content of the shared buffers by loading a scratch
+// table as large as the buffer cache. The operating system page cache is
+// not affected, evicted pages may still be read without disk access.
+type Evictor struct {
+	db db.DB
+}
+
+func NewEvictor(ctx context.Context, db db.DB) (*Evictor, error) {
+	_, err := db.Exec(ctx, "create extension if not exists pg_prewarm")
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not create extension pg_prewarm")
+	}
+	var sharedBufferPages int64
+	err = db.QueryRow(ctx, sharedBuffersStatement).Scan(&sharedBufferPages)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not read shared_buffers")
+	}
+	_, err = db.Exec(ctx, fmt.Sprintf("drop table if exists %s", evictionTable))
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not drop eviction table")
+	}
+	_, err = db.Exec(ctx, fmt.Sprintf("create unlogged table %s (filler text)", evictionTable))
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not create eviction table")
+	}
+	// Filler values are not compressed below the TOAST threshold.
+	_, err = db.Exec(
+		ctx,
+		fmt.Sprintf("insert into %s select repeat('x', 1000) from generate_series(1, $1)", evictionTable),
+		sharedBufferPages*evictionRowsPerPage,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not populate eviction table")
+	}
+	return &Evictor{db: db}, nil
+}
+
+func (e *Evictor) Evict(ctx context.Context) error {
+	_, err := e.db.Exec(ctx, fmt.Sprintf("select pg_prewarm('%s', 'buffer')", evictionTable))
+	if err != nil {
+		return errors.Wrap(err, "Could not evict shared buffers")
+	}
+	return nil
+}
+
+func (e *Evictor) Close(ctx context.Context) error {
+	_, err := e.db.Exec(ctx, fmt.Sprintf("drop table if exists %s", evictionTable))
+	if err != nil {
+		return errors.Wrap(err, "Could not drop eviction table")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrewarm(t *testing.T) {
+	fake := dbtest.New().On("from pg_index", dbtest.Result{Rows: [][]any{{"alerts_pkey"}, {"alerts_clusterid_idx"}}})
+	require.NoError(t, Prewarm(context.Background(), fake, []string{"Alerts"}))
+
+	// The indexes are loaded before their table.
+	calls := fake.Calls()
+	require.Len(t, calls, 5)
+	assert.Equal(t, "create extension if not exists pg_prewarm", calls[0].SQL)
+	assert.Equal(t, indexesStatement, calls[1].SQL)
+	assert.Equal(t, []any{"Alerts"}, calls[1].Args)
+	for ix, relation := range []string{"alerts_pkey", "alerts_clusterid_idx", "Alerts"} {
+		assert.Equal(t, "select pg_prewarm($1::regclass)", calls[ix+2].SQL)
+		assert.Equal(t, []any{relation}, calls[ix+2].Args)
+	}
+}
+
+func TestPrewarmError(t *testing.T) {
+	failure := errors.New(`relation "alerts" does not exist`)
+	fake := dbtest.New().On("select pg_prewarm", dbtest.Result{Err: failure})
+	err := Prewarm(context.Background(), fake, []string{"alerts", "images"})
+	assert.ErrorIs(t, err, failure)
+	assert.Contains(t, err.Error(), `Could not prewarm "alerts"`)
+	assert.Len(t, fake.Calls(), 3)
+
+	fake = dbtest.New().On("from pg_index", dbtest.Result{Err: failure})
+	err = Prewarm(context.Background(), fake, []string{"alerts"})
+	assert.ErrorIs(t, err, failure)
+	assert.Contains(t, err.Error(), `Could not list indexes of "alerts"`)
+}
+
+func TestEvictor(t *testing.T) {
+	fake := dbtest.New().On(sharedBuffersStatement, dbtest.Result{Rows: [][]any{{int64(16384)}}})
+	evictor, err := NewEvictor(context.Background(), fake)
+	require.NoError(t, err)
+	require.NoError(t, evictor.Evict(context.Background()))
+	require.NoError(t, evictor.Close(context.Background()))
+
+	// The table fills the 16384 pages of the shared buffers.
+	calls := fake.Calls()
+	require.Len(t, calls, 7)
+	assert.Equal(t, []string{
+		"create extension if not exists pg_prewarm",
+		sharedBuffersStatement,
+		"drop table if exists sacsqlperf_eviction",
+		"create unlogged table sacsqlperf_eviction (filler text)",
+		"insert into sacsqlperf_eviction select repeat('x', 1000) from generate_series(1, $1)",
+		"select pg_prewarm('sacsqlperf_eviction', 'buffer')",
+		"drop table if exists sacsqlperf_eviction",
+	}, fake.Statements())
+	assert.Equal(t, []any{int64(16384 * evictionRowsPerPage)}, calls[4].Args)
+}
+
+func TestEvictorError(t *testing.T) {
+	failure := errors.New(`permission denied for table pg_settings`)
+	fake := dbtest.New().On(sharedBuffersStatement, dbtest.Result{Err: failure})
+	_, err := NewEvictor(context.Background(), fake)
+	assert.ErrorIs(t, err, failure)
+	assert.Contains(t, err.Error(), "Could not read shared_buffers")
+	assert.Len(t, fake.Calls(), 2, "no table is created")
+
+	failure = errors.New(`could not extend file: No space left on device`)
+	fake = dbtest.New().
+		On(sharedBuffersStatement, dbtest.Result{Rows: [][]any{{int64(16384)}}}).
+		On("insert into sacsqlperf_eviction", dbtest.Result{Err: failure})
+	_, err = NewEvictor(context.Background(), fake)
+	assert.ErrorIs(t, err, failure)
+	assert.Contains(t, err.Error(), "Could not populate eviction table")
+}
@@ -0,0 +1,84 @@
+package catalog
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+)
+
+// Load reads a JSON array of query definitions.
+func Load(path string) ([]*query.Query, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not read query catalog %q", path)
+	}
+	queries := make([]*query.Query, 0)
+	if err = json.Unmarshal(data, &queries); err != nil {
+		return nil, errors.Wrapf(err, "Could not decode query catalog %q", path)
+	}
+	if err = Validate(queries); err != nil {
+		return nil, errors.Wrapf(err, "Invalid query catalog %q", path)
+	}
+	return queries, nil
+}
+
+// Validate checks that every query has a unique name and renders as a
+// well-formed statement.
+func Validate(queries []*query.Query) error {
+	names := make(map[string]struct{}, len(queries))
+	for ix, q := range queries {
+		if q.Name == "" {
+			return errors.Errorf("query at index %d has no name", ix)
+		}
+		if _, found := names[q.Name]; found {
+			return errors.Errorf("duplicate query name %q", q.Name)
+		}
+		names[q.Name] = struct{}{}
+		if err := q.Validate(); err != nil {
+			return errors.Wrapf(err, "Invalid query %q", q.Name)
+		}
+	}
+	return nil
+}
+
+// ParseList splits a comma separated command line value.
+func ParseList(value string) []string {
+	result := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// Select returns the queries with one of the given names or carrying one of
+// the given tags, in catalog order. All queries are selected when no name
+// and no tag is given.
+func Select(queries []*query.Query, names []string, tags []string) ([]*query.Query, error) {
+	if len(names) == 0 && len(tags) == 0 {
+		return queries, nil
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(queries, func(q *query.Query) bool { return q.Name == name }) {
+			return nil, errors.Errorf("unknown query %q", name)
+		}
+	}
+	for _, tag := range tags {
+		if !slices.ContainsFunc(queries, func(q *query.Query) bool { return slices.Contains(q.Tags, tag) }) {
+			return nil, errors.Errorf("unknown tag %q", tag)
+		}
+	}
+	selected := make([]*query.Query, 0, len(queries))
+	for _, q := range queries {
+		if slices.Contains(names, q.Name) || slices.ContainsFunc(tags, func(tag string) bool { return slices.Contains(q.Tags, tag) }) {
+			selected = append(selected, q)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,94 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	queries, err := Load("testdata/catalog.json")
+	require.NoError(t, err)
+	require.Len(t, queries, 2)
+
+	alerts := queries[0]
+	assert.Equal(t, "alerts-by-severity", alerts.Name)
+	assert.Equal(t, []string{"alerts", "dashboard"}, alerts.Tags)
+	assert.Equal(t, &query.WcOr{
+		Operands: []query.WhereClausePart{
+			&query.QualifiedColumn{TableName: "alerts", ColumnName: "State", Value: int64(0)},
+			&query.QualifiedColumn{TableName: "alerts", ColumnName: "State", Value: int64(3)},
+		},
+	}, alerts.WhereClause)
+	stmt, bindValues := alerts.ForExecution()
+	assert.Equal(t, "select policy_severity, count(*) from alerts where ( alerts.State = $1 or alerts.State = $2 ) group by alerts.Policy_Severity", stmt)
+	assert.Equal(t, []interface{}{int64(0), int64(3)}, bindValues)
+
+	deployments := queries[1]
+	assert.Nil(t, deployments.WhereClause)
+	assert.Equal(t, &query.Pagination{Limit: 50}, deployments.QueryPagination)
+}
+
+func namedQuery(name string) *query.Query {
+	return &query.Query{
+		Name:             name,
+		Statement:        "select",
+		StatementTargets: []query.Target{query.Raw("count(*)")},
+		TargetTables:     []string{"alerts"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate([]*query.Query{namedQuery("a"), namedQuery("b")}))
+	assert.Error(t, Validate([]*query.Query{namedQuery("a"), namedQuery("")}))
+	assert.Error(t, Validate([]*query.Query{namedQuery("a"), namedQuery("a")}))
+
+	unsafe := namedQuery("unsafe")
+	unsafe.StatementTargets = []query.Target{query.Raw("1; drop table alerts")}
+	assert.ErrorContains(t, Validate([]*query.Query{unsafe}), `Invalid query "unsafe"`)
+}
+
+func TestSelect(t *testing.T) {
+	queries := []*query.Query{
+		{Name: "images-by-risk", Tags: []string{"images", "vuln-mgmt", "dashboard"}},
+		{Name: "alerts-by-severity", Tags: []string{"alerts", "dashboard"}},
+		{Name: "deployments-by-name", Tags: []string{"deployments"}},
+	}
+	testCases := []struct {
+		name     string
+		names    []string
+		tags     []string
+		expected []string
+		fails    bool
+	}{
+		{name: "all", expected: []string{"images-by-risk", "alerts-by-severity", "deployments-by-name"}},
+		{name: "by name", names: []string{"deployments-by-name", "images-by-risk"}, expected: []string{"images-by-risk", "deployments-by-name"}},
+		{name: "by tag", tags: []string{"dashboard"}, expected: []string{"images-by-risk", "alerts-by-severity"}},
+		{name: "by name or tag", names: []string{"deployments-by-name"}, tags: []string{"alerts"}, expected: []string{"alerts-by-severity", "deployments-by-name"}},
+		{name: "unknown name", names: []string{"nodes"}, fails: true},
+		{name: "unknown tag", tags: []string{"nodes"}, fails: true},
+		{name: "name, unknown tag", names: []string{"deployments-by-name"}, tags: []string{"nodes"}, fails: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(it *testing.T) {
+			selected, err := Select(queries, tc.names, tc.tags)
+			if tc.fails {
+				assert.Error(it, err)
+				return
+			}
+			require.NoError(it, err)
+			names := make([]string, 0, len(selected))
+			for _, q := range selected {
+				names = append(names, q.Name)
+			}
+			assert.Equal(it, tc.expected, names)
+		})
+	}
+}
+
+func TestParseList(t *testing.T) {
+	assert.Equal(t, []string{}, ParseList(""))
+	assert.Equal(t, []string{"alerts", "vuln-mgmt"}, ParseList(" alerts, ,vuln-mgmt "))
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/ctxwatch"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
 )
@@ -12,6 +16,11 @@ import (
 const (
 	currentDatabase = "central_active"
 
+	// cancelDeadlineDelay bounds the wait for the server to acknowledge the
+	// cancel request of a cancelled statement, the connection is closed past
+	// it.
+	cancelDeadlineDelay = 5 * time.Second
+
 	databasePasswordFile = "/var/run/secrets/stackrox.io/db-password/password"
 
 	databaseConfigSource = `host=central-db.stackrox.svc
@@ -26,6 +35,22 @@ client_encoding=UTF8
 password=%s`
 )
 
+// DB is the subset of the database operations used by the tool. It is
+// implemented by the pgx connection pool and transactions, and by the fake
+// of the dbtest package.
+type DB interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Begin(ctx context.Context) (pgx.Tx, error)
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+var (
+	_ DB = (*pgxpool.Pool)(nil)
+	_ DB = (pgx.Tx)(nil)
+)
+
 func getDBConfig() (*pgxpool.Config, error) {
 	password, err := os.ReadFile(databasePasswordFile)
 	if err != nil {
@@ -45,12 +70,33 @@ func GetDBConn(ctx context.Context) (*pgxpool.Pool, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "Could not get postgres config")
 	}
+	return connect(ctx, config)
+}
+
+// Connect opens a connection pool on the database of the connection string,
+// for instance one outside of a Central deployment.
+func Connect(ctx context.Context, connString string) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not parse postgres config")
+	}
+	return connect(ctx, config)
+}
+
+// connect opens the pool. A cancelled context sends a cancel request to the
+// server, so that a timed out statement does not keep running there: by
+// default, pgx only closes the connection on its side.
+func connect(ctx context.Context, config *pgxpool.Config) (*pgxpool.Pool, error) {
+	config.ConnConfig.BuildContextWatcherHandler = func(conn *pgconn.PgConn) ctxwatch.Handler {
+		return &pgconn.CancelRequestContextWatcherHandler{Conn: conn, DeadlineDelay: cancelDeadlineDelay}
+	}
 	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, errors.Wrap(err, "Could not get postgres pool")
 	}
 	_, err = pool.Exec(ctx, "create extension if not exists pg_stat_statements")
 	if err != nil {
+		pool.Close()
 		return nil, errors.Wrap(err, "Could not create extension pg_stat_statements")
 	}
 	return pool, nil
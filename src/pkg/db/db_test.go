@@ -0,0 +1,32 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db/pgtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCancelOnServer(t *testing.T) {
+	pool := pgtest.Start(t).Connect(t)
+	ctx := context.Background()
+
+	timeout, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	_, err := pool.Exec(timeout, "select pg_sleep(60)")
+	require.Error(t, err)
+
+	// The statement is cancelled on the server, not only abandoned by the
+	// client.
+	assert.Eventually(t, func() bool {
+		running := 0
+		err := pool.QueryRow(
+			ctx,
+			"select count(*) from pg_stat_activity where state = 'active' and query = 'select pg_sleep(60)'",
+		).Scan(&running)
+		return err == nil && running == 0
+	}, 10*time.Second, 100*time.Millisecond)
+}
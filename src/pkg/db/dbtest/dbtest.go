@@ -0,0 +1,285 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+)
+
+const (
+	StatementBegin    = "begin"
+	StatementCommit   = "commit"
+	StatementRollback = "rollback"
+)
+
+// Call is a statement received by the fake database, with its arguments.
+// The arguments of a copy are the copied rows.
+type Call struct {
+	SQL  string
+	Args []any
+}
+
+// Result is the answer of the fake database to a statement: the rows of a
+// query, the command tag of an exec, or an error.
+type Result struct {
+	Rows       [][]any
+	CommandTag string
+	Err        error
+}
+
+type response struct {
+	match  string
+	result Result
+}
+
+// DB is a fake database recording the statements it receives. Statements
+// are answered with the result of the first registration matching them,
+// and with an empty result when none does.
+type DB struct {
+	lock      sync.Mutex
+	calls     []Call
+	responses []response
+}
+
+var _ db.DB = (*DB)(nil)
+
+func New() *DB {
+	return &DB{}
+}
+
+// On registers the result of the statements containing the given text.
+func (d *DB) On(match string, result Result) *DB {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.responses = append(d.responses, response{match: match, result: result})
+	return d
+}
+
+// Calls returns the statements received so far, transaction boundaries
+// included.
+func (d *DB) Calls() []Call {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	calls := make([]Call, len(d.calls))
+	copy(calls, d.calls)
+	return calls
+}
+
+// Statements returns the SQL of the statements received so far.
+func (d *DB) Statements() []string {
+	calls := d.Calls()
+	statements := make([]string, 0, len(calls))
+	for _, call := range calls {
+		statements = append(statements, call.SQL)
+	}
+	return statements
+}
+
+func (d *DB) record(sql string, args []any) Result {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.calls = append(d.calls, Call{SQL: sql, Args: args})
+	for _, r := range d.responses {
+		if strings.Contains(sql, r.match) {
+			return r.result
+		}
+	}
+	return Result{}
+}
+
+func (d *DB) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	result := d.record(sql, args)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	return &rows{rows: result.Rows, position: -1, commandTag: result.CommandTag}, nil
+}
+
+func (d *DB) QueryRow(_ context.Context, sql string, args ...any) pgx.Row {
+	result := d.record(sql, args)
+	return &row{result: result}
+}
+
+func (d *DB) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	result := d.record(sql, args)
+	return pgconn.NewCommandTag(result.CommandTag), result.Err
+}
+
+// CopyFrom records a "copy <table> (<columns>) from stdin" statement.
+func (d *DB) CopyFrom(_ context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	copied := make([]any, 0)
+	for rowSrc.Next() {
+		values, err := rowSrc.Values()
+		if err != nil {
+			return 0, err
+		}
+		copied = append(copied, values)
+	}
+	if err := rowSrc.Err(); err != nil {
+		return 0, err
+	}
+	stmt := fmt.Sprintf("copy %s (%s) from stdin", tableName.Sanitize(), strings.Join(columnNames, ", "))
+	result := d.record(stmt, copied)
+	if result.Err != nil {
+		return 0, result.Err
+	}
+	return int64(len(copied)), nil
+}
+
+func (d *DB) Begin(_ context.Context) (pgx.Tx, error) {
+	result := d.record(StatementBegin, nil)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	return &tx{DB: d}, nil
+}
+
+// tx runs its statements on the fake database. The operations the tool
+// does not use are left to the embedded nil interface and panic.
+type tx struct {
+	pgx.Tx
+	*DB
+	closed bool
+}
+
+func (t *tx) Begin(ctx context.Context) (pgx.Tx, error) {
+	return t.DB.Begin(ctx)
+}
+
+func (t *tx) Commit(_ context.Context) error {
+	if t.closed {
+		return pgx.ErrTxClosed
+	}
+	t.closed = true
+	return t.record(StatementCommit, nil).Err
+}
+
+func (t *tx) Rollback(_ context.Context) error {
+	if t.closed {
+		return pgx.ErrTxClosed
+	}
+	t.closed = true
+	return t.record(StatementRollback, nil).Err
+}
+
+func (t *tx) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	return t.DB.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+func (t *tx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return t.DB.Exec(ctx, sql, args...)
+}
+
+func (t *tx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return t.DB.Query(ctx, sql, args...)
+}
+
+func (t *tx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return t.DB.QueryRow(ctx, sql, args...)
+}
+
+type row struct {
+	result Result
+}
+
+func (r *row) Scan(dest ...any) error {
+	if r.result.Err != nil {
+		return r.result.Err
+	}
+	if len(r.result.Rows) == 0 {
+		return pgx.ErrNoRows
+	}
+	return scan(r.result.Rows[0], dest)
+}
+
+type rows struct {
+	rows       [][]any
+	position   int
+	commandTag string
+	err        error
+}
+
+func (r *rows) Close() {}
+
+func (r *rows) Err() error {
+	return r.err
+}
+
+func (r *rows) CommandTag() pgconn.CommandTag {
+	return pgconn.NewCommandTag(r.commandTag)
+}
+
+func (r *rows) FieldDescriptions() []pgconn.FieldDescription {
+	return nil
+}
+
+func (r *rows) Next() bool {
+	if r.err != nil || r.position+1 >= len(r.rows) {
+		return false
+	}
+	r.position++
+	return true
+}
+
+func (r *rows) Scan(dest ...any) error {
+	if r.position < 0 || r.position >= len(r.rows) {
+		return fmt.Errorf("no current row")
+	}
+	err := scan(r.rows[r.position], dest)
+	if err != nil {
+		r.err = err
+	}
+	return err
+}
+
+func (r *rows) Values() ([]any, error) {
+	if r.position < 0 || r.position >= len(r.rows) {
+		return nil, fmt.Errorf("no current row")
+	}
+	return r.rows[r.position], nil
+}
+
+func (r *rows) RawValues() [][]byte {
+	return nil
+}
+
+func (r *rows) Conn() *pgx.Conn {
+	return nil
+}
+
+// scan assigns the row values to the destination pointers, converting
+// between the numeric types and from strings to byte slices.
+func scan(values []any, dest []any) error {
+	if len(values) != len(dest) {
+		return fmt.Errorf("row has %d values, %d destinations given", len(values), len(dest))
+	}
+	for i, value := range values {
+		target := reflect.ValueOf(dest[i])
+		if target.Kind() != reflect.Pointer || target.IsNil() {
+			return fmt.Errorf("destination %d is not a pointer", i)
+		}
+		target = target.Elem()
+		if value == nil {
+			target.SetZero()
+			continue
+		}
+		source := reflect.ValueOf(value)
+		switch {
+		case source.Type().AssignableTo(target.Type()):
+			target.Set(source)
+		case source.CanConvert(target.Type()) && source.Kind() != reflect.String && target.Kind() != reflect.String:
+			target.Set(source.Convert(target.Type()))
+		case source.Kind() == reflect.String && target.Type() == reflect.TypeOf([]byte(nil)):
+			target.SetBytes([]byte(source.String()))
+		default:
+			return fmt.Errorf("cannot scan %T into %s", value, target.Type())
+		}
+	}
+	return nil
+}
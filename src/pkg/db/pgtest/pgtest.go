@@ -0,0 +1,153 @@
+package pgtest
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/generator"
+)
+
+const (
+	// binDirVariable names the environment variable giving the directory of
+	// the Postgres binaries when they are not on the PATH.
+	binDirVariable = "SACSQLPERF_PG_BIN"
+
+	port     = 5432
+	user     = "postgres"
+	database = "central_active"
+)
+
+//go:embed seed.sql
+var Seed string
+
+// Server is a throwaway Postgres cluster in a temporary directory, stopped
+// and removed at the end of the test.
+type Server struct {
+	ConnString string
+	pgCtl      string
+	dataDir    string
+	socketDir  string
+}
+
+// Start initializes and starts a Postgres cluster with pg_stat_statements
+// loaded, and creates an empty central_active database. The test is skipped
+// when the Postgres binaries are not available or in short mode.
+func Start(t testing.TB) *Server {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping Postgres integration test in short mode")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("skipping Postgres integration test, Postgres cannot run as root")
+	}
+	initDB, err := lookPath("initdb")
+	if err != nil {
+		t.Skipf("skipping Postgres integration test, initdb not found on PATH or in $%s", binDirVariable)
+	}
+	pgCtl, err := lookPath("pg_ctl")
+	if err != nil {
+		t.Skipf("skipping Postgres integration test, pg_ctl not found on PATH or in $%s", binDirVariable)
+	}
+	root := t.TempDir()
+	server := &Server{pgCtl: pgCtl, dataDir: filepath.Join(root, "data"), socketDir: root}
+	run(t, initDB, "--pgdata", server.dataDir, "--username", user, "--auth", "trust", "--encoding", "UTF8", "--no-sync")
+
+	// The server only listens on a socket of the temporary directory, the
+	// port does not conflict with other servers.
+	options := fmt.Sprintf(
+		"-p %d -k %s -c listen_addresses='' -c shared_preload_libraries=pg_stat_statements -c fsync=off",
+		port,
+		root,
+	)
+	run(t, pgCtl, "start", "--pgdata", server.dataDir, "--log", filepath.Join(root, "postgres.log"), "--wait", "-o", options)
+	t.Cleanup(func() {
+		_ = exec.Command(pgCtl, "stop", "--pgdata", server.dataDir, "--mode", "immediate").Run()
+	})
+
+	server.ConnString = server.NewDatabase(t, database)
+	return server
+}
+
+// NewDatabase creates an empty database on the server and returns its
+// connection string.
+func (s *Server) NewDatabase(t testing.TB, name string) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	admin, err := pgxpool.New(ctx, s.connString("postgres"))
+	if err != nil {
+		t.Fatalf("Could not connect to the test server: %v", err)
+	}
+	defer admin.Close()
+	if _, err = admin.Exec(ctx, "create database "+name); err != nil {
+		t.Fatalf("Could not create database %s: %v", name, err)
+	}
+	return s.connString(name)
+}
+
+func (s *Server) connString(name string) string {
+	return fmt.Sprintf("host=%s port=%d user=%s dbname=%s sslmode=disable", s.socketDir, port, user, name)
+}
+
+// StartCentral starts a server and loads the reduced Central schema of the
+// generator and the seed data.
+func StartCentral(t testing.TB) *Server {
+	t.Helper()
+	server := Start(t)
+	pool := server.Connect(t)
+	Load(t, pool, generator.Schema)
+	Load(t, pool, Seed)
+	return server
+}
+
+// Connect opens a pool on the test database, closed at the end of the test.
+func (s *Server) Connect(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+	return ConnectTo(t, s.ConnString)
+}
+
+// ConnectTo opens a pool on the database of the connection string, closed
+// at the end of the test.
+func ConnectTo(t testing.TB, connString string) *pgxpool.Pool {
+	t.Helper()
+	pool, err := db.Connect(context.Background(), connString)
+	if err != nil {
+		t.Fatalf("Could not connect to the test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// Load runs a SQL script on the test database.
+func Load(t testing.TB, pool *pgxpool.Pool, script string) {
+	t.Helper()
+	if _, err := pool.Exec(context.Background(), script); err != nil {
+		t.Fatalf("Could not load SQL script: %v", err)
+	}
+}
+
+func lookPath(name string) (string, error) {
+	if binDir := os.Getenv(binDirVariable); binDir != "" {
+		path := filepath.Join(binDir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return exec.LookPath(name)
+}
+
+func run(t testing.TB, name string, args ...string) {
+	t.Helper()
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Could not run %s: %v\n%s", filepath.Base(name), err, output)
+	}
+}
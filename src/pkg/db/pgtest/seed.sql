@@ -0,0 +1,30 @@
+-- 3 clusters of 10 namespaces, 4 deployments of 2 containers per namespace,
+-- 25 images and 5 alerts per deployment. Identifiers are derived from the
+-- names so that the data is the same on every load.
+insert into clusters (id, name)
+select md5('cluster-' || c)::uuid, 'cluster-' || c
+from generate_series(1, 3) c;
+
+insert into namespaces (id, name, clusterid, clustername)
+select md5('namespace-' || c || '-' || n)::uuid, 'namespace-' || n, md5('cluster-' || c)::uuid, 'cluster-' || c
+from generate_series(1, 3) c, generate_series(1, 10) n;
+
+insert into deployments (id, name, namespace, namespaceid, clusterid, clustername, riskscore)
+select md5('deployment-' || ns.id || '-' || d)::uuid, 'deployment-' || d, ns.name, ns.id, ns.clusterid, ns.clustername, (d * 7 % 10)::numeric
+from namespaces ns, generate_series(1, 4) d;
+
+insert into images (id, name_fullname, riskscore)
+select 'sha256:' || md5('image-' || i), 'registry.example.com/image-' || i, (i % 13)::numeric
+from generate_series(1, 25) i;
+
+insert into deployments_containers (deployments_id, idx, image_id, image_name_fullname)
+select dep.id, c, 'sha256:' || md5('image-' || image), 'registry.example.com/image-' || image
+from deployments dep, generate_series(0, 1) c,
+lateral (select abs(hashtext(dep.id::text || c)) % 25 + 1 as image) i;
+
+insert into alerts (id, policy_id, policy_name, policy_severity, lifecyclestage, clusterid, clustername, namespace, namespaceid, deployment_id, state, time)
+select md5('alert-' || dep.id || '-' || a)::uuid, 'policy-' || (a % 5), 'Policy ' || (a % 5), a % 4 + 1, 1,
+dep.clusterid, dep.clustername, dep.namespace, dep.namespaceid, dep.id, a % 4, timestamp '2024-11-18' - make_interval(hours => a)
+from deployments dep, generate_series(1, 5) a;
+
+analyze;
@@ -0,0 +1,86 @@
+package explain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+)
+
+const explainOptions = "verbose, analyze, buffers, settings, format json"
+
+type Node struct {
+	NodeType          string  `json:"Node Type"`
+	RelationName      string  `json:"Relation Name,omitempty"`
+	IndexName         string  `json:"Index Name,omitempty"`
+	StartupCost       float64 `json:"Startup Cost"`
+	TotalCost         float64 `json:"Total Cost"`
+	PlanRows          float64 `json:"Plan Rows"`
+	ActualTotalTime   float64 `json:"Actual Total Time"`
+	ActualRows        float64 `json:"Actual Rows"`
+	ActualLoops       float64 `json:"Actual Loops"`
+	SharedHitBlocks   int64   `json:"Shared Hit Blocks"`
+	SharedReadBlocks  int64   `json:"Shared Read Blocks"`
+	LocalHitBlocks    int64   `json:"Local Hit Blocks"`
+	LocalReadBlocks   int64   `json:"Local Read Blocks"`
+	TempReadBlocks    int64   `json:"Temp Read Blocks"`
+	TempWrittenBlocks int64   `json:"Temp Written Blocks"`
+	Plans             []Node  `json:"Plans,omitempty"`
+}
+
+type Plan struct {
+	Plan          Node              `json:"Plan"`
+	PlanningTime  float64           `json:"Planning Time"`
+	ExecutionTime float64           `json:"Execution Time"`
+	Settings      map[string]string `json:"Settings,omitempty"`
+	Raw           json.RawMessage   `json:"-"`
+}
+
+// Statement wraps the given statement in the explain command used by the tool.
+func Statement(stmt string) string {
+	return fmt.Sprintf("explain (%s) %s", explainOptions, stmt)
+}
+
+type planFields Plan
+
+// UnmarshalJSON decodes the output of an explain command run with the json
+// format, keeping the raw output.
+func (p *Plan) UnmarshalJSON(raw []byte) error {
+	plans := make([]planFields, 0, 1)
+	if err := json.Unmarshal(raw, &plans); err != nil {
+		return errors.Wrap(err, "Could not decode execution plan")
+	}
+	if len(plans) != 1 {
+		return errors.Errorf("Expected 1 execution plan, got %d", len(plans))
+	}
+	*p = Plan(plans[0])
+	p.Raw = append(json.RawMessage(nil), raw...)
+	return nil
+}
+
+// MarshalJSON returns the raw explain output the plan was decoded from.
+func (p *Plan) MarshalJSON() ([]byte, error) {
+	if len(p.Raw) > 0 {
+		return p.Raw, nil
+	}
+	return json.Marshal([]planFields{planFields(*p)})
+}
+
+func Parse(raw []byte) (*Plan, error) {
+	plan := &Plan{}
+	if err := json.Unmarshal(raw, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func Run(ctx context.Context, db db.DB, stmt string, bindValues ...interface{}) (*Plan, error) {
+	var raw string
+	err := db.QueryRow(ctx, Statement(stmt), bindValues...).Scan(&raw)
+	if err != nil {
+		return nil, err
+	}
+	return Parse([]byte(raw))
+}
@@ -0,0 +1,109 @@
+package explain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const samplePlan = `[
+  {
+    "Plan": {
+      "Node Type": "Aggregate",
+      "Startup Cost": 10.5,
+      "Total Cost": 10.51,
+      "Plan Rows": 1,
+      "Actual Total Time": 0.2,
+      "Actual Rows": 1,
+      "Actual Loops": 1,
+      "Shared Hit Blocks": 12,
+      "Shared Read Blocks": 3,
+      "Plans": [
+        {
+          "Node Type": "Index Scan",
+          "Relation Name": "alerts",
+          "Index Name": "alerts_sac_filter",
+          "Startup Cost": 0.29,
+          "Total Cost": 10.4,
+          "Plan Rows": 40,
+          "Actual Total Time": 0.15,
+          "Actual Rows": 38,
+          "Actual Loops": 1,
+          "Shared Hit Blocks": 12,
+          "Shared Read Blocks": 3
+        }
+      ]
+    },
+    "Settings": {
+      "work_mem": "64MB"
+    },
+    "Planning Time": 0.412,
+    "Triggers": [],
+    "Execution Time": 0.251
+  }
+]`
+
+func TestParse(t *testing.T) {
+	plan, err := Parse([]byte(samplePlan))
+	require.NoError(t, err)
+	assert.Equal(t, 0.412, plan.PlanningTime)
+	assert.Equal(t, 0.251, plan.ExecutionTime)
+	assert.Equal(t, "Aggregate", plan.Plan.NodeType)
+	assert.Equal(t, int64(12), plan.Plan.SharedHitBlocks)
+	assert.Equal(t, int64(3), plan.Plan.SharedReadBlocks)
+	require.Len(t, plan.Plan.Plans, 1)
+	assert.Equal(t, "alerts", plan.Plan.Plans[0].RelationName)
+	assert.Equal(t, "alerts_sac_filter", plan.Plan.Plans[0].IndexName)
+	assert.Equal(t, map[string]string{"work_mem": "64MB"}, plan.Settings)
+	assert.Equal(t, samplePlan, string(plan.Raw))
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse([]byte("not json"))
+	assert.Error(t, err)
+	_, err = Parse([]byte("[]"))
+	assert.Error(t, err)
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	plan, err := Parse([]byte(samplePlan))
+	require.NoError(t, err)
+	encoded, err := json.Marshal(struct {
+		Plan *Plan `json:"plan"`
+	}{Plan: plan})
+	require.NoError(t, err)
+	decoded := struct {
+		Plan *Plan `json:"plan"`
+	}{}
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, plan.PlanningTime, decoded.Plan.PlanningTime)
+	assert.Equal(t, plan.Plan, decoded.Plan.Plan)
+
+	plan.Raw = nil
+	encoded, err = json.Marshal(plan)
+	require.NoError(t, err)
+	decodedPlan, err := Parse(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, plan.Plan, decodedPlan.Plan)
+}
+
+func TestRun(t *testing.T) {
+	fake := dbtest.New().On("explain", dbtest.Result{Rows: [][]any{{samplePlan}}})
+	plan, err := Run(context.Background(), fake, "select count(*) from alerts where alerts.State = $1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0.412, plan.PlanningTime)
+	assert.Equal(t, []dbtest.Call{{
+		SQL:  Statement("select count(*) from alerts where alerts.State = $1"),
+		Args: []any{0},
+	}}, fake.Calls())
+
+	failure := errors.New("canceling statement due to statement timeout")
+	fake = dbtest.New().On("explain", dbtest.Result{Err: failure})
+	_, err = Run(context.Background(), fake, "select count(*) from alerts")
+	assert.ErrorIs(t, err, failure)
+}
@@ -0,0 +1,452 @@
+package generator
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+)
+
+//go:embed schema.sql
+var Schema string
+
+const dropStatement = "drop table if exists alerts, deployments_containers, images, deployments, namespaces, clusters cascade"
+
+// systemNamespaces are found in every cluster, before the application ones.
+var systemNamespaces = []string{"default", "kube-system", "stackrox"}
+
+// Alert states and severities follow the storage enums of Central.
+var (
+	stateWeights    = map[int]float64{0: 0.6, 1: 0.05, 2: 0.25, 3: 0.1}
+	severityWeights = map[int]float64{1: 0.4, 2: 0.3, 3: 0.2, 4: 0.1}
+)
+
+// Config describes the shape of the generated dataset. The namespaces are
+// spread over the clusters, the deployments over the namespaces, the image
+// references and the alerts over the images and deployments, following Zipf
+// distributions of the given exponents: 0 spreads evenly, higher values
+// concentrate the rows on a few clusters, namespaces, images or deployments.
+type Config struct {
+	Clusters                int
+	Namespaces              int
+	NamespaceSkew           float64
+	Deployments             int
+	DeploymentSkew          float64
+	ContainersPerDeployment int
+	Images                  int
+	ImageSkew               float64
+	Alerts                  int
+	AlertSkew               float64
+	Seed                    int64
+}
+
+// DefaultConfig matches the scale cluster the SAC issues were reproduced on.
+func DefaultConfig() Config {
+	return Config{
+		Clusters:                10,
+		Namespaces:              5000,
+		NamespaceSkew:           1,
+		Deployments:             20000,
+		DeploymentSkew:          1,
+		ContainersPerDeployment: 2,
+		Images:                  3000,
+		ImageSkew:               1.2,
+		Alerts:                  80000,
+		AlertSkew:               1,
+		Seed:                    1,
+	}
+}
+
+func (c Config) Validate() error {
+	if c.Clusters < 1 {
+		return errors.Errorf("invalid number of clusters %d", c.Clusters)
+	}
+	if c.Namespaces < c.Clusters {
+		return errors.Errorf("invalid number of namespaces %d, at least one per cluster is needed", c.Namespaces)
+	}
+	if c.Deployments < 0 || c.Alerts < 0 {
+		return errors.New("invalid negative number of deployments or alerts")
+	}
+	if c.ContainersPerDeployment < 1 || c.Images < 1 {
+		return errors.New("at least one container per deployment and one image are needed")
+	}
+	if c.Alerts > 0 && c.Deployments == 0 {
+		return errors.New("alerts need deployments")
+	}
+	for _, skew := range []float64{c.NamespaceSkew, c.DeploymentSkew, c.ImageSkew, c.AlertSkew} {
+		if skew < 0 {
+			return errors.Errorf("invalid negative skew %g", skew)
+		}
+	}
+	return nil
+}
+
+type Cluster struct {
+	ID   pgtype.UUID
+	Name string
+}
+
+type Namespace struct {
+	ID      pgtype.UUID
+	Name    string
+	Cluster *Cluster
+}
+
+type Image struct {
+	ID        string
+	Name      string
+	RiskScore float64
+}
+
+type Deployment struct {
+	ID        pgtype.UUID
+	Name      string
+	Namespace *Namespace
+	RiskScore float64
+	Images    []*Image
+}
+
+type Alert struct {
+	ID             pgtype.UUID
+	PolicyID       string
+	PolicyName     string
+	PolicySeverity int
+	Deployment     *Deployment
+	State          int
+	Time           time.Time
+}
+
+// Dataset is a generated set of Central rows.
+type Dataset struct {
+	Clusters    []*Cluster
+	Namespaces  []*Namespace
+	Images      []*Image
+	Deployments []*Deployment
+	Alerts      []*Alert
+}
+
+// Generate produces the dataset of the configuration. The same seed
+// produces the same dataset.
+func Generate(config Config, now time.Time) *Dataset {
+	randGen := rand.New(rand.NewSource(config.Seed))
+	dataset := &Dataset{}
+
+	for i := 0; i < config.Clusters; i++ {
+		dataset.Clusters = append(dataset.Clusters, &Cluster{
+			ID:   newUUID(randGen),
+			Name: fmt.Sprintf("cluster-%03d", i+1),
+		})
+	}
+	namespaceCounts := distribute(config.Namespaces, zipfWeights(config.Clusters, config.NamespaceSkew), 1)
+	for clusterIx, cluster := range dataset.Clusters {
+		for i := 0; i < namespaceCounts[clusterIx]; i++ {
+			name := fmt.Sprintf("app-%04d", i+1-len(systemNamespaces))
+			if i < len(systemNamespaces) {
+				name = systemNamespaces[i]
+			}
+			dataset.Namespaces = append(dataset.Namespaces, &Namespace{
+				ID:      newUUID(randGen),
+				Name:    name,
+				Cluster: cluster,
+			})
+		}
+	}
+
+	for i := 0; i < config.Images; i++ {
+		dataset.Images = append(dataset.Images, &Image{
+			ID:        fmt.Sprintf("sha256:%016x%016x", randGen.Uint64(), randGen.Uint64()),
+			Name:      fmt.Sprintf("registry.example.com/team-%02d/image-%04d:latest", i%50, i+1),
+			RiskScore: riskScore(randGen),
+		})
+	}
+	imageWeights := cumulative(zipfWeights(config.Images, config.ImageSkew))
+
+	deploymentCounts := distribute(
+		config.Deployments,
+		shuffled(randGen, zipfWeights(len(dataset.Namespaces), config.DeploymentSkew)),
+		0,
+	)
+	for namespaceIx, namespace := range dataset.Namespaces {
+		for i := 0; i < deploymentCounts[namespaceIx]; i++ {
+			deployment := &Deployment{
+				ID:        newUUID(randGen),
+				Name:      fmt.Sprintf("deployment-%03d", i+1),
+				Namespace: namespace,
+			}
+			containers := 1 + randGen.Intn(2*config.ContainersPerDeployment-1)
+			for c := 0; c < containers; c++ {
+				image := dataset.Images[pick(randGen, imageWeights)]
+				deployment.Images = append(deployment.Images, image)
+				deployment.RiskScore = math.Max(deployment.RiskScore, image.RiskScore)
+			}
+			dataset.Deployments = append(dataset.Deployments, deployment)
+		}
+	}
+
+	if len(dataset.Deployments) > 0 {
+		alertCounts := distribute(
+			config.Alerts,
+			shuffled(randGen, zipfWeights(len(dataset.Deployments), config.AlertSkew)),
+			0,
+		)
+		states := newWeightedValues(stateWeights)
+		severities := newWeightedValues(severityWeights)
+		for deploymentIx, deployment := range dataset.Deployments {
+			for i := 0; i < alertCounts[deploymentIx]; i++ {
+				policy := randGen.Intn(100)
+				dataset.Alerts = append(dataset.Alerts, &Alert{
+					ID:             newUUID(randGen),
+					PolicyID:       fmt.Sprintf("policy-%03d", policy),
+					PolicyName:     fmt.Sprintf("Policy %d", policy),
+					PolicySeverity: severities.pick(randGen),
+					Deployment:     deployment,
+					State:          states.pick(randGen),
+					Time:           now.Add(-time.Duration(randGen.Int63n(int64(30 * 24 * time.Hour)))),
+				})
+			}
+		}
+	}
+	return dataset
+}
+
+// Load creates the tables of the reduced Central schema, after dropping
+// the existing ones when reset is set, and copies the dataset into them, in
+// one transaction.
+func Load(ctx context.Context, database db.DB, dataset *Dataset, reset bool) error {
+	tx, err := database.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Could not begin transaction")
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if reset {
+		if _, err := tx.Exec(ctx, dropStatement); err != nil {
+			return errors.Wrap(err, "Could not drop tables")
+		}
+	}
+	if _, err := tx.Exec(ctx, Schema); err != nil {
+		return errors.Wrap(err, "Could not create tables")
+	}
+	tables := []struct {
+		name    string
+		columns []string
+		rows    [][]any
+	}{
+		{name: "clusters", columns: []string{"id", "name"}, rows: dataset.clusterRows()},
+		{name: "namespaces", columns: []string{"id", "name", "clusterid", "clustername"}, rows: dataset.namespaceRows()},
+		{
+			name:    "deployments",
+			columns: []string{"id", "name", "namespace", "namespaceid", "clusterid", "clustername", "riskscore"},
+			rows:    dataset.deploymentRows(),
+		},
+		{name: "images", columns: []string{"id", "name_fullname", "riskscore"}, rows: dataset.imageRows()},
+		{
+			name:    "deployments_containers",
+			columns: []string{"deployments_id", "idx", "image_id", "image_name_fullname"},
+			rows:    dataset.containerRows(),
+		},
+		{
+			name: "alerts",
+			columns: []string{
+				"id", "policy_id", "policy_name", "policy_severity", "lifecyclestage",
+				"clusterid", "clustername", "namespace", "namespaceid", "deployment_id", "state", "time",
+			},
+			rows: dataset.alertRows(),
+		},
+	}
+	for _, table := range tables {
+		fmt.Printf("Loading %d rows in table %q\n", len(table.rows), table.name)
+		_, err := tx.CopyFrom(ctx, pgx.Identifier{table.name}, table.columns, pgx.CopyFromRows(table.rows))
+		if err != nil {
+			return errors.Wrapf(err, "Could not load table %q", table.name)
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "Could not commit load")
+	}
+	if _, err := database.Exec(ctx, "analyze"); err != nil {
+		return errors.Wrap(err, "Could not analyze tables")
+	}
+	return nil
+}
+
+func (d *Dataset) clusterRows() [][]any {
+	rows := make([][]any, 0, len(d.Clusters))
+	for _, cluster := range d.Clusters {
+		rows = append(rows, []any{cluster.ID, cluster.Name})
+	}
+	return rows
+}
+
+func (d *Dataset) namespaceRows() [][]any {
+	rows := make([][]any, 0, len(d.Namespaces))
+	for _, namespace := range d.Namespaces {
+		rows = append(rows, []any{namespace.ID, namespace.Name, namespace.Cluster.ID, namespace.Cluster.Name})
+	}
+	return rows
+}
+
+func (d *Dataset) deploymentRows() [][]any {
+	rows := make([][]any, 0, len(d.Deployments))
+	for _, deployment := range d.Deployments {
+		namespace := deployment.Namespace
+		rows = append(rows, []any{
+			deployment.ID,
+			deployment.Name,
+			namespace.Name,
+			namespace.ID,
+			namespace.Cluster.ID,
+			namespace.Cluster.Name,
+			deployment.RiskScore,
+		})
+	}
+	return rows
+}
+
+func (d *Dataset) imageRows() [][]any {
+	rows := make([][]any, 0, len(d.Images))
+	for _, image := range d.Images {
+		rows = append(rows, []any{image.ID, image.Name, image.RiskScore})
+	}
+	return rows
+}
+
+func (d *Dataset) containerRows() [][]any {
+	rows := make([][]any, 0, len(d.Deployments))
+	for _, deployment := range d.Deployments {
+		for ix, image := range deployment.Images {
+			rows = append(rows, []any{deployment.ID, ix, image.ID, image.Name})
+		}
+	}
+	return rows
+}
+
+func (d *Dataset) alertRows() [][]any {
+	rows := make([][]any, 0, len(d.Alerts))
+	for _, alert := range d.Alerts {
+		deployment := alert.Deployment
+		namespace := deployment.Namespace
+		rows = append(rows, []any{
+			alert.ID,
+			alert.PolicyID,
+			alert.PolicyName,
+			alert.PolicySeverity,
+			1,
+			namespace.Cluster.ID,
+			namespace.Cluster.Name,
+			namespace.Name,
+			namespace.ID,
+			deployment.ID,
+			alert.State,
+			alert.Time,
+		})
+	}
+	return rows
+}
+
+func newUUID(randGen *rand.Rand) pgtype.UUID {
+	id := pgtype.UUID{Valid: true}
+	randGen.Read(id.Bytes[:])
+	// Version 4, variant 10.
+	id.Bytes[6] = id.Bytes[6]&0x0f | 0x40
+	id.Bytes[8] = id.Bytes[8]&0x3f | 0x80
+	return id
+}
+
+// riskScore draws a log-normal score: most images are low risk, a few are
+// much riskier.
+func riskScore(randGen *rand.Rand) float64 {
+	return math.Round(math.Exp(randGen.NormFloat64()*0.8+0.5)*100) / 100
+}
+
+// zipfWeights returns the weights of n ranks, proportional to 1/rank^skew.
+func zipfWeights(n int, skew float64) []float64 {
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1 / math.Pow(float64(i+1), skew)
+	}
+	return weights
+}
+
+func shuffled(randGen *rand.Rand, weights []float64) []float64 {
+	randGen.Shuffle(len(weights), func(i, j int) { weights[i], weights[j] = weights[j], weights[i] })
+	return weights
+}
+
+// distribute splits total in parts proportional to the weights, each part
+// being at least minimum, using the largest remainders to round.
+func distribute(total int, weights []float64, minimum int) []int {
+	counts := make([]int, len(weights))
+	remaining := total - minimum*len(weights)
+	if remaining < 0 {
+		remaining = 0
+	}
+	sum := 0.0
+	for _, weight := range weights {
+		sum += weight
+	}
+	remainders := make([]float64, len(weights))
+	assigned := 0
+	for i, weight := range weights {
+		share := float64(remaining) * weight / sum
+		counts[i] = minimum + int(share)
+		remainders[i] = share - math.Floor(share)
+		assigned += int(share)
+	}
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return remainders[order[i]] > remainders[order[j]] })
+	for i := 0; assigned < remaining; i++ {
+		counts[order[i]]++
+		assigned++
+	}
+	return counts
+}
+
+func cumulative(weights []float64) []float64 {
+	result := make([]float64, len(weights))
+	sum := 0.0
+	for i, weight := range weights {
+		sum += weight
+		result[i] = sum
+	}
+	return result
+}
+
+// pick draws an index with the probabilities of the cumulative weights.
+func pick(randGen *rand.Rand, cumulativeWeights []float64) int {
+	target := randGen.Float64() * cumulativeWeights[len(cumulativeWeights)-1]
+	return sort.SearchFloat64s(cumulativeWeights, target)
+}
+
+type weightedValues struct {
+	values  []int
+	weights []float64
+}
+
+func newWeightedValues(weights map[int]float64) *weightedValues {
+	result := &weightedValues{}
+	for value := range weights {
+		result.values = append(result.values, value)
+	}
+	sort.Ints(result.values)
+	plain := make([]float64, 0, len(result.values))
+	for _, value := range result.values {
+		plain = append(plain, weights[value])
+	}
+	result.weights = cumulative(plain)
+	return result
+}
+
+func (w *weightedValues) pick(randGen *rand.Rand) int {
+	return w.values[pick(randGen, w.weights)]
+}
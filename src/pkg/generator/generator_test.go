@@ -0,0 +1,149 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2024, 11, 18, 0, 0, 0, 0, time.UTC)
+
+func smallConfig() Config {
+	return Config{
+		Clusters:                4,
+		Namespaces:              200,
+		NamespaceSkew:           1,
+		Deployments:             1000,
+		DeploymentSkew:          1,
+		ContainersPerDeployment: 2,
+		Images:                  100,
+		ImageSkew:               1.2,
+		Alerts:                  3000,
+		AlertSkew:               1,
+		Seed:                    7,
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	config := smallConfig()
+	require.NoError(t, config.Validate())
+	dataset := Generate(config, now)
+	assert.Len(t, dataset.Clusters, 4)
+	assert.Len(t, dataset.Namespaces, 200)
+	assert.Len(t, dataset.Deployments, 1000)
+	assert.Len(t, dataset.Images, 100)
+	assert.Len(t, dataset.Alerts, 3000)
+
+	namespacesByCluster := make(map[string]map[string]struct{})
+	for _, namespace := range dataset.Namespaces {
+		names, found := namespacesByCluster[namespace.Cluster.Name]
+		if !found {
+			names = make(map[string]struct{})
+			namespacesByCluster[namespace.Cluster.Name] = names
+		}
+		_, duplicate := names[namespace.Name]
+		assert.False(t, duplicate, "namespace %s/%s", namespace.Cluster.Name, namespace.Name)
+		names[namespace.Name] = struct{}{}
+	}
+	require.Len(t, namespacesByCluster, 4)
+	assert.Greater(t, len(namespacesByCluster["cluster-001"]), 2*len(namespacesByCluster["cluster-004"]))
+	assert.Contains(t, namespacesByCluster["cluster-004"], "stackrox")
+
+	for _, alert := range dataset.Alerts {
+		assert.Contains(t, []int{0, 1, 2, 3}, alert.State)
+		assert.Contains(t, []int{1, 2, 3, 4}, alert.PolicySeverity)
+		assert.False(t, alert.Time.After(now))
+	}
+	for _, deployment := range dataset.Deployments {
+		assert.NotEmpty(t, deployment.Images)
+		assert.LessOrEqual(t, len(deployment.Images), 3)
+	}
+
+	again := Generate(config, now)
+	assert.Equal(t, dataset.Alerts[42].ID, again.Alerts[42].ID)
+	assert.Equal(t, dataset.Deployments[10].Namespace.Name, again.Deployments[10].Namespace.Name)
+}
+
+func TestDistribute(t *testing.T) {
+	for name, tc := range map[string]struct {
+		total    int
+		weights  []float64
+		minimum  int
+		expected []int
+	}{
+		"even": {
+			total:    10,
+			weights:  []float64{1, 1, 1, 1, 1},
+			expected: []int{2, 2, 2, 2, 2},
+		},
+		"rounded by largest remainder": {
+			total:    10,
+			weights:  []float64{1, 1, 1},
+			expected: []int{4, 3, 3},
+		},
+		"skewed with minimum": {
+			total:    10,
+			weights:  []float64{1, 0.5, 0.25, 0.25},
+			minimum:  1,
+			expected: []int{4, 2, 2, 2},
+		},
+		"total below minimum": {
+			total:    2,
+			weights:  []float64{1, 1, 1},
+			minimum:  1,
+			expected: []int{1, 1, 1},
+		},
+	} {
+		t.Run(name, func(it *testing.T) {
+			assert.Equal(it, tc.expected, distribute(tc.total, tc.weights, tc.minimum))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	config := smallConfig()
+	config.Namespaces = 3
+	assert.Error(t, config.Validate())
+	config = smallConfig()
+	config.Deployments = 0
+	assert.Error(t, config.Validate())
+	config = smallConfig()
+	config.ImageSkew = -1
+	assert.Error(t, config.Validate())
+	assert.NoError(t, DefaultConfig().Validate())
+}
+
+func TestLoad(t *testing.T) {
+	config := smallConfig()
+	dataset := Generate(config, now)
+	fake := dbtest.New()
+	require.NoError(t, Load(context.Background(), fake, dataset, true))
+
+	calls := fake.Calls()
+	require.Len(t, calls, 11)
+	assert.Equal(t, dbtest.StatementBegin, calls[0].SQL)
+	assert.Equal(t, dropStatement, calls[1].SQL)
+	assert.Equal(t, Schema, calls[2].SQL)
+	assert.Equal(t, `copy "clusters" (id, name) from stdin`, calls[3].SQL)
+	assert.Len(t, calls[3].Args, 4)
+	assert.True(t, strings.HasPrefix(calls[8].SQL, `copy "alerts" (`))
+	assert.Len(t, calls[8].Args, 3000)
+	alertRow := calls[8].Args[0].([]any)
+	assert.Len(t, alertRow, 12)
+	assert.Equal(t, dbtest.StatementCommit, calls[9].SQL)
+	assert.Equal(t, "analyze", calls[10].SQL)
+}
+
+func TestLoadRollback(t *testing.T) {
+	fake := dbtest.New().On(`copy "images"`, dbtest.Result{Err: errors.New("copy failed")})
+	require.Error(t, Load(context.Background(), fake, Generate(smallConfig(), now), false))
+	statements := fake.Statements()
+	assert.Equal(t, dbtest.StatementRollback, statements[len(statements)-1])
+	assert.NotContains(t, statements, dbtest.StatementCommit)
+}
@@ -0,0 +1,56 @@
+-- Reduced Central schema: the tables and columns used by the SAC queries,
+-- with the scope indexes of the Central database.
+create table clusters (
+    id uuid primary key,
+    name varchar unique
+);
+
+create table namespaces (
+    id uuid primary key,
+    name varchar,
+    clusterid uuid references clusters(id) on delete cascade,
+    clustername varchar
+);
+create index namespaces_sac_filter on namespaces using btree (clusterid, name);
+
+create table deployments (
+    id uuid primary key,
+    name varchar,
+    namespace varchar,
+    namespaceid uuid,
+    clusterid uuid,
+    clustername varchar,
+    riskscore numeric
+);
+create index deployments_sac_filter on deployments using btree (namespace, clusterid);
+
+create table images (
+    id varchar primary key,
+    name_fullname varchar,
+    riskscore numeric
+);
+
+create table deployments_containers (
+    deployments_id uuid references deployments(id) on delete cascade,
+    idx integer,
+    image_id varchar,
+    image_name_fullname varchar,
+    primary key (deployments_id, idx)
+);
+create index deploymentscontainers_image_id on deployments_containers using hash (image_id);
+
+create table alerts (
+    id uuid primary key,
+    policy_id varchar,
+    policy_name varchar,
+    policy_severity integer,
+    lifecyclestage integer,
+    clusterid uuid,
+    clustername varchar,
+    namespace varchar,
+    namespaceid uuid,
+    deployment_id uuid,
+    state integer,
+    time timestamp
+);
+create index alerts_sac_filter on alerts using btree (namespace, clusterid);
@@ -0,0 +1,192 @@
+package htmlreport
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	chartWidth        = 640
+	chartHeight       = 320
+	chartMarginLeft   = 70
+	chartMarginRight  = 180
+	chartMarginTop    = 30
+	chartMarginBottom = 50
+	chartYTicks       = 5
+)
+
+var seriesColors = []string{
+	"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f",
+}
+
+type point struct {
+	size  int
+	value float64
+}
+
+type series struct {
+	name   string
+	points []point
+}
+
+// chart plots values against scope sizes, with a logarithmic scale for the
+// sizes since the tested sizes grow geometrically.
+type chart struct {
+	title  string
+	unit   string
+	series []*series
+}
+
+func (c *chart) add(seriesName string, size int, value float64) {
+	for _, s := range c.series {
+		if s.name == seriesName {
+			s.points = append(s.points, point{size: size, value: value})
+			return
+		}
+	}
+	c.series = append(c.series, &series{name: seriesName, points: []point{{size: size, value: value}}})
+}
+
+func (c *chart) sizes() []int {
+	seen := make(map[int]struct{})
+	sizes := make([]int, 0)
+	for _, s := range c.series {
+		for _, p := range s.points {
+			if _, found := seen[p.size]; found {
+				continue
+			}
+			seen[p.size] = struct{}{}
+			sizes = append(sizes, p.size)
+		}
+	}
+	sort.Ints(sizes)
+	return sizes
+}
+
+func (c *chart) maxValue() float64 {
+	maxValue := 0.0
+	for _, s := range c.series {
+		for _, p := range s.points {
+			maxValue = math.Max(maxValue, p.value)
+		}
+	}
+	if maxValue <= 0 {
+		return 1
+	}
+	return maxValue
+}
+
+func (c *chart) SVG() template.HTML {
+	sizes := c.sizes()
+	if len(sizes) == 0 {
+		return ""
+	}
+	plotWidth := float64(chartWidth - chartMarginLeft - chartMarginRight)
+	plotHeight := float64(chartHeight - chartMarginTop - chartMarginBottom)
+	minLog := math.Log10(float64(max(sizes[0], 1)))
+	maxLog := math.Log10(float64(max(sizes[len(sizes)-1], 1)))
+	x := func(size int) float64 {
+		if maxLog == minLog {
+			return chartMarginLeft + plotWidth/2
+		}
+		return chartMarginLeft + (math.Log10(float64(max(size, 1)))-minLog)/(maxLog-minLog)*plotWidth
+	}
+	maxValue := c.maxValue()
+	y := func(value float64) float64 {
+		return chartMarginTop + plotHeight - value/maxValue*plotHeight
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" class="chart">`,
+		chartWidth,
+		chartHeight,
+	))
+	sb.WriteString(fmt.Sprintf(
+		`<text x="%d" y="18" class="title">%s</text>`,
+		chartMarginLeft,
+		html.EscapeString(c.title),
+	))
+	sb.WriteString(fmt.Sprintf(
+		`<rect x="%d" y="%d" width="%.0f" height="%.0f" class="frame"/>`,
+		chartMarginLeft,
+		chartMarginTop,
+		plotWidth,
+		plotHeight,
+	))
+	for i := 0; i <= chartYTicks; i++ {
+		value := maxValue * float64(i) / chartYTicks
+		sb.WriteString(fmt.Sprintf(
+			`<line x1="%d" x2="%.1f" y1="%.1f" y2="%.1f" class="grid"/><text x="%d" y="%.1f" class="ytick">%.3g</text>`,
+			chartMarginLeft,
+			chartMarginLeft+plotWidth,
+			y(value),
+			y(value),
+			chartMarginLeft-5,
+			y(value)+4,
+			value,
+		))
+	}
+	for _, size := range sizes {
+		sb.WriteString(fmt.Sprintf(
+			`<text x="%.1f" y="%.1f" class="xtick">%d</text>`,
+			x(size),
+			chartMarginTop+plotHeight+15,
+			size,
+		))
+	}
+	sb.WriteString(fmt.Sprintf(
+		`<text x="%.1f" y="%d" class="xlabel">scope size (namespaces)</text>`,
+		chartMarginLeft+plotWidth/2,
+		chartHeight-8,
+	))
+	sb.WriteString(fmt.Sprintf(
+		`<text x="15" y="%.1f" class="ylabel" transform="rotate(-90 15 %.1f)">%s</text>`,
+		chartMarginTop+plotHeight/2,
+		chartMarginTop+plotHeight/2,
+		html.EscapeString(c.unit),
+	))
+	for ix, s := range c.series {
+		color := seriesColors[ix%len(seriesColors)]
+		points := make([]point, len(s.points))
+		copy(points, s.points)
+		sort.Slice(points, func(i, j int) bool { return points[i].size < points[j].size })
+		coordinates := make([]string, 0, len(points))
+		for _, p := range points {
+			coordinates = append(coordinates, fmt.Sprintf("%.1f,%.1f", x(p.size), y(p.value)))
+		}
+		sb.WriteString(fmt.Sprintf(
+			`<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`,
+			strings.Join(coordinates, " "),
+			color,
+		))
+		for _, p := range points {
+			sb.WriteString(fmt.Sprintf(
+				`<circle cx="%.1f" cy="%.1f" r="3" fill="%s"><title>%s: %d namespaces, %.3f %s</title></circle>`,
+				x(p.size),
+				y(p.value),
+				color,
+				html.EscapeString(s.name),
+				p.size,
+				p.value,
+				html.EscapeString(c.unit),
+			))
+		}
+		legendY := chartMarginTop + 10 + 18*ix
+		sb.WriteString(fmt.Sprintf(
+			`<rect x="%.1f" y="%d" width="12" height="12" fill="%s"/><text x="%.1f" y="%d" class="legend">%s</text>`,
+			chartMarginLeft+plotWidth+10,
+			legendY-10,
+			color,
+			chartMarginLeft+plotWidth+28,
+			legendY,
+			html.EscapeString(s.name),
+		))
+	}
+	sb.WriteString(`</svg>`)
+	return template.HTML(sb.String())
+}
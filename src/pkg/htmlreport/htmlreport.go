@@ -0,0 +1,180 @@
+package htmlreport
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/report"
+)
+
+type entryView struct {
+	*report.Entry
+	// Instance is the parameter values of the query, within the section of
+	// its template, e.g. [severity=3].
+	Instance      string
+	PlanningTime  float64
+	ExecutionTime float64
+}
+
+// querySection presents the entries of a query, or of all the instances of
+// a query template.
+type querySection struct {
+	Name      string
+	Query     *query.Query
+	Instances []string
+	Baselines []*entryView
+	Charts    []*chart
+	Entries   []*entryView
+}
+
+type page struct {
+	Report  *report.Report
+	Queries []*querySection
+}
+
+// measurement returns the steady state measurements of the entry when the
+// query was executed several times, the ones of its single execution
+// otherwise.
+func measurement(entry *report.Entry) (float64, float64) {
+	if warm := entry.Warm(); warm != nil {
+		return warm.PlanningTime, warm.ExecutionTime
+	}
+	if first := entry.First(); first != nil {
+		return first.PlanningTime, first.ExecutionTime
+	}
+	if entry.Plan != nil {
+		return entry.Plan.PlanningTime, entry.Plan.ExecutionTime
+	}
+	return 0, 0
+}
+
+func seriesName(view *entryView) string {
+	name := fmt.Sprintf("%s / %s", view.Selection, view.Injection)
+	if view.Rendering != report.RenderingDefault {
+		name = fmt.Sprintf("%s / %s", name, view.Rendering)
+	}
+	if view.Instance != "" {
+		name = fmt.Sprintf("%s %s", view.Instance, name)
+	}
+	return name
+}
+
+func buildPage(r *report.Report) *page {
+	p := &page{Report: r}
+	sectionsByName := make(map[string]*querySection)
+	for _, entry := range r.Entries {
+		name := entry.Query
+		if entry.Template != "" {
+			name = entry.Template
+		}
+		section, found := sectionsByName[name]
+		if !found {
+			section = &querySection{
+				Name:  name,
+				Query: r.Query(entry.Query),
+				Charts: []*chart{
+					{title: "Planning time", unit: "ms"},
+					{title: "Execution time", unit: "ms"},
+				},
+			}
+			sectionsByName[name] = section
+			p.Queries = append(p.Queries, section)
+		}
+		view := &entryView{Entry: entry}
+		if entry.Template != "" {
+			view.Instance = strings.TrimPrefix(entry.Query, entry.Template)
+			if !slices.Contains(section.Instances, view.Instance) {
+				section.Instances = append(section.Instances, view.Instance)
+			}
+		}
+		view.PlanningTime, view.ExecutionTime = measurement(entry)
+		section.Entries = append(section.Entries, view)
+		if entry.Selection == report.SelectionNone {
+			section.Baselines = append(section.Baselines, view)
+			continue
+		}
+		if entry.Error != "" {
+			continue
+		}
+		section.Charts[0].add(seriesName(view), entry.ScopeSize, view.PlanningTime)
+		section.Charts[1].add(seriesName(view), entry.ScopeSize, view.ExecutionTime)
+	}
+	return p
+}
+
+// Render writes a self-contained HTML page presenting the results of a run.
+func Render(w io.Writer, r *report.Report) error {
+	err := pageTemplate.Execute(w, buildPage(r))
+	if err != nil {
+		return errors.Wrap(err, "Could not render HTML report")
+	}
+	return nil
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>SAC SQL performance report - {{.Report.Database}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { background: #f4f4f4; padding: 0.5em; white-space: pre-wrap; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.5em; text-align: right; }
+td.text, th.text { text-align: left; }
+details { margin-left: 1em; }
+.error { color: #d62728; }
+.chart .title { font-weight: bold; font-size: 14px; }
+.chart .frame { fill: none; stroke: #999; }
+.chart .grid { stroke: #eee; }
+.chart .ytick { font-size: 11px; text-anchor: end; }
+.chart .xtick { font-size: 11px; text-anchor: middle; }
+.chart .xlabel, .chart .ylabel { font-size: 12px; text-anchor: middle; }
+.chart .legend { font-size: 12px; }
+</style>
+</head>
+<body>
+<h1>SAC SQL performance report</h1>
+<p>Database {{.Report.Database}}, run started at {{.Report.StartedAt.Format "2006-01-02 15:04:05 MST"}}.</p>
+<p>Times are the mean of the steady state executions when a query was run more than once.</p>
+{{range .Queries}}
+<h2>{{.Name}}</h2>
+{{with .Instances}}<p>Template expanded in {{len .}} queries: {{range $ix, $instance := .}}{{if $ix}}, {{end}}{{$instance}}{{end}}</p>{{end}}
+{{with .Query}}{{with .Description}}<p>{{.}}</p>{{end}}
+{{with .Origin}}<p>Origin: {{.}}</p>{{end}}
+{{with .Tags}}<p>Tags: {{range $ix, $tag := .}}{{if $ix}}, {{end}}{{$tag}}{{end}}</p>{{end}}{{end}}
+{{range .Baselines}}<p>{{with .Instance}}{{.}} without{{else}}Without{{end}} scope: planning {{printf "%.3f" .PlanningTime}} ms, execution {{printf "%.3f" .ExecutionTime}} ms.</p>
+<pre>{{.Statement}}</pre>{{end}}
+{{range .Charts}}{{.SVG}}{{end}}
+<table>
+<tr><th class="text">Selection</th><th class="text">Injection</th><th>Scope size</th><th>Planning (ms)</th><th>Execution (ms)</th><th>Shared hits</th><th>Shared reads</th></tr>
+{{range .Entries}}<tr>
+<td class="text">{{with .Instance}}{{.}} {{end}}{{.Selection}}</td><td class="text">{{.Injection}}{{with .Rendering}} / {{.}}{{end}}</td><td>{{.ScopeSize}}</td>
+<td>{{printf "%.3f" .PlanningTime}}</td><td>{{printf "%.3f" .ExecutionTime}}</td>
+{{with .Plan}}<td>{{.Plan.SharedHitBlocks}}</td><td>{{.Plan.SharedReadBlocks}}</td>{{else}}<td></td><td></td>{{end}}
+</tr>{{end}}
+</table>
+{{range .Entries}}
+<details>
+<summary>{{with .Instance}}{{.}} {{end}}{{.Selection}} / {{.Injection}}{{with .Rendering}} / {{.}}{{end}}, {{.ScopeSize}} namespaces{{with .ScopeStats}} in {{.Clusters}} clusters{{if .Table}}, {{.RowsCovered}} of {{.TotalRows}} {{.Table}} rows{{end}}{{end}}{{with .Fallback}}, {{.}} fallback{{end}}{{if .Error}} <span class="error">{{with .Status}}{{.}}: {{end}}{{.Error}}</span>{{end}}
+{{with .Verification}}{{if .Reference}}{{if .Match}}same rows as {{.Reference}}{{else}}<span class="error">{{.Rows}} rows differing from {{.Reference}}</span>{{end}}{{end}}{{end}}</summary>
+<pre>{{.Statement}}</pre>
+{{with .Plan}}{{template "node" .Plan}}{{end}}
+</details>
+{{end}}
+{{end}}
+</body>
+</html>
+{{define "node"}}<details open>
+<summary>{{.NodeType}}{{with .RelationName}} on {{.}}{{end}}{{with .IndexName}} using {{.}}{{end}}
+(cost {{printf "%.2f" .StartupCost}}..{{printf "%.2f" .TotalCost}}, rows {{printf "%.0f" .PlanRows}})
+(actual {{printf "%.3f" .ActualTotalTime}} ms, rows {{printf "%.0f" .ActualRows}}, loops {{printf "%.0f" .ActualLoops}})
+(shared hit {{.SharedHitBlocks}}, read {{.SharedReadBlocks}})</summary>
+{{range .Plans}}{{template "node" .}}{{end}}
+</details>{{end}}
+`))
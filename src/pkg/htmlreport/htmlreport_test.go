@@ -0,0 +1,111 @@
+package htmlreport
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/explain"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/report"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/verify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	r := report.New("central_active")
+	r.Queries = []*query.Query{
+		{Name: "query-0", Description: "Alert count", Tags: []string{"alerts", "dashboard"}},
+	}
+	r.Add(&report.Entry{
+		Query:      "query-0",
+		Statement:  "select count(*) from alerts where alerts.State = $1",
+		Selection:  report.SelectionNone,
+		Injection:  report.InjectionNone,
+		Executions: []report.Execution{{Iteration: 1, PlanningTime: 0.5, ExecutionTime: 3}},
+	})
+	for _, size := range []int{10, 100} {
+		r.Add(&report.Entry{
+			Query:     "query-0",
+			Statement: "select count(*) from alerts where ( alerts.ClusterId = $1 ) and alerts.State = $2",
+			Selection: report.SelectionOrdered,
+			Injection: report.InjectionOrTree,
+			ScopeSize: size,
+			Plan: &explain.Plan{
+				Plan: explain.Node{
+					NodeType: "Aggregate",
+					Plans:    []explain.Node{{NodeType: "Seq Scan", RelationName: "alerts"}},
+				},
+			},
+			Executions: []report.Execution{
+				{Iteration: 1, PlanningTime: 2, ExecutionTime: 20},
+				{Iteration: 2, PlanningTime: 1, ExecutionTime: float64(size)},
+			},
+		})
+	}
+	r.Add(&report.Entry{
+		Query:     "query-0",
+		Selection: report.SelectionRandom,
+		Injection: report.InjectionOrTree,
+		ScopeSize: 10,
+		Error:     "canceling statement <due to timeout>",
+	})
+
+	r.Add(&report.Entry{
+		Query:        "query-0",
+		Selection:    report.SelectionOrdered,
+		Injection:    report.InjectionExists,
+		ScopeSize:    10,
+		Verification: &verify.Result{Rows: 12, Checksum: "a", Reference: report.InjectionOrTree},
+	})
+
+	var sb strings.Builder
+	require.NoError(t, Render(&sb, r))
+	page := sb.String()
+	assert.Contains(t, page, "<h2>query-0</h2>")
+	assert.Contains(t, page, "<p>Alert count</p>")
+	assert.Contains(t, page, "<p>Tags: alerts, dashboard</p>")
+	assert.Contains(t, page, "Without scope: planning 0.500 ms, execution 3.000 ms.")
+	assert.Equal(t, 2, strings.Count(page, "<svg"))
+	assert.Contains(t, page, "ordered / or-tree: 100 namespaces, 100.000 ms")
+	assert.Contains(t, page, "Seq Scan on alerts")
+	assert.Contains(t, page, "canceling statement &lt;due to timeout&gt;")
+	assert.NotContains(t, page, "random / or-tree:")
+	assert.Contains(t, page, "12 rows differing from or-tree")
+}
+
+func TestRenderTemplate(t *testing.T) {
+	r := report.New("central_active")
+	r.Queries = []*query.Query{
+		{Name: "alerts[severity=1]", Template: "alerts", Description: "Alerts of a severity"},
+		{Name: "alerts[severity=3]", Template: "alerts", Description: "Alerts of a severity"},
+	}
+	for _, instance := range r.Queries {
+		r.Add(&report.Entry{
+			Query:      instance.Name,
+			Template:   instance.Template,
+			Selection:  report.SelectionNone,
+			Injection:  report.InjectionNone,
+			Executions: []report.Execution{{Iteration: 1, PlanningTime: 0.5, ExecutionTime: 3}},
+		})
+		r.Add(&report.Entry{
+			Query:      instance.Name,
+			Template:   instance.Template,
+			Selection:  report.SelectionOrdered,
+			Injection:  report.InjectionOrTree,
+			ScopeSize:  10,
+			Executions: []report.Execution{{Iteration: 1, PlanningTime: 1, ExecutionTime: 20}},
+		})
+	}
+
+	var sb strings.Builder
+	require.NoError(t, Render(&sb, r))
+	page := sb.String()
+	assert.Equal(t, 1, strings.Count(page, "<h2>"))
+	assert.Contains(t, page, "<h2>alerts</h2>")
+	assert.Contains(t, page, "Template expanded in 2 queries: [severity=1], [severity=3]")
+	assert.Contains(t, page, "[severity=3] without scope: planning 0.500 ms")
+	assert.Equal(t, 2, strings.Count(page, "<svg"))
+	assert.Contains(t, page, "[severity=1] ordered / or-tree: 10 namespaces, 20.000 ms")
+	assert.Contains(t, page, "[severity=3] ordered / or-tree: 10 namespaces, 20.000 ms")
+}
@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/report"
+)
+
+const namespace = "sacsqlperf"
+
+// Time buckets in seconds, doubling from 1ms to a little over a minute.
+var timeBuckets = func() []float64 {
+	buckets := make([]float64, 0, 17)
+	for bucket := 0.001; bucket < 100; bucket *= 2 {
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}()
+
+type labels struct {
+	query     string
+	scopeSize string
+	selection string
+	injection string
+	rendering string
+}
+
+func labelsOf(entry *report.Entry) labels {
+	return labels{
+		query:     entry.Query,
+		scopeSize: strconv.Itoa(entry.ScopeSize),
+		selection: entry.Selection,
+		injection: entry.Injection,
+		rendering: entry.Rendering,
+	}
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func (l labels) String() string {
+	return fmt.Sprintf(
+		`query="%s",scope_size="%s",selection="%s",injection="%s",rendering="%s"`,
+		escapeLabelValue(l.query),
+		escapeLabelValue(l.scopeSize),
+		escapeLabelValue(l.selection),
+		escapeLabelValue(l.injection),
+		escapeLabelValue(l.rendering),
+	)
+}
+
+func sortedLabels[V any](values map[labels]V) []labels {
+	keys := make([]labels, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	return keys
+}
+
+type histogramValue struct {
+	bucketCounts []uint64
+	count        uint64
+	sum          float64
+}
+
+type histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	values  map[labels]*histogramValue
+}
+
+func newHistogram(name string, help string, buckets []float64) *histogram {
+	return &histogram{name: name, help: help, buckets: buckets, values: make(map[labels]*histogramValue)}
+}
+
+func (h *histogram) observe(l labels, value float64) {
+	v, found := h.values[l]
+	if !found {
+		v = &histogramValue{bucketCounts: make([]uint64, len(h.buckets))}
+		h.values[l] = v
+	}
+	for ix, bucket := range h.buckets {
+		if value <= bucket {
+			v.bucketCounts[ix]++
+		}
+	}
+	v.count++
+	v.sum += value
+}
+
+func (h *histogram) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, l := range sortedLabels(h.values) {
+		v := h.values[l]
+		for ix, bucket := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%g\"} %d\n", h.name, l, bucket, v.bucketCounts[ix])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, l, v.count)
+		fmt.Fprintf(w, "%s_sum{%s} %g\n", h.name, l, v.sum)
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, l, v.count)
+	}
+}
+
+// scalar is a gauge or a counter.
+type scalar struct {
+	name       string
+	help       string
+	metricType string
+	values     map[labels]float64
+}
+
+func newScalar(name string, help string, metricType string) *scalar {
+	return &scalar{name: name, help: help, metricType: metricType, values: make(map[labels]float64)}
+}
+
+func (s *scalar) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.name, s.help, s.name, s.metricType)
+	for _, l := range sortedLabels(s.values) {
+		fmt.Fprintf(w, "%s{%s} %g\n", s.name, l, s.values[l])
+	}
+}
+
+// Registry holds the metrics derived from the report entries, and exposes
+// them in the Prometheus text format.
+type Registry struct {
+	lock sync.Mutex
+
+	executionTime    *histogram
+	planningTime     *histogram
+	rows             *scalar
+	sharedHitBlocks  *scalar
+	sharedReadBlocks *scalar
+	errors           *scalar
+	entries          *scalar
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		executionTime: newHistogram(
+			namespace+"_execution_time_seconds",
+			"Execution time of the profiled queries.",
+			timeBuckets,
+		),
+		planningTime: newHistogram(
+			namespace+"_planning_time_seconds",
+			"Planning time of the profiled queries.",
+			timeBuckets,
+		),
+		rows: newScalar(
+			namespace+"_rows",
+			"Number of rows returned by the last execution of the profiled queries.",
+			"gauge",
+		),
+		sharedHitBlocks: newScalar(
+			namespace+"_shared_hit_blocks",
+			"Shared buffer hits of the last execution of the profiled queries.",
+			"gauge",
+		),
+		sharedReadBlocks: newScalar(
+			namespace+"_shared_read_blocks",
+			"Shared blocks read by the last execution of the profiled queries.",
+			"gauge",
+		),
+		errors: newScalar(
+			namespace+"_errors_total",
+			"Number of profiling attempts that failed.",
+			"counter",
+		),
+		entries: newScalar(
+			namespace+"_entries_total",
+			"Number of profiling attempts.",
+			"counter",
+		),
+	}
+}
+
+func (r *Registry) Observe(entry *report.Entry) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	l := labelsOf(entry)
+	r.entries.values[l]++
+	if entry.Error != "" {
+		r.errors.values[l]++
+	}
+	for _, execution := range entry.Executions {
+		r.planningTime.observe(l, execution.PlanningTime/1000)
+		r.executionTime.observe(l, execution.ExecutionTime/1000)
+	}
+	if len(entry.Executions) > 0 {
+		last := entry.Executions[len(entry.Executions)-1]
+		r.sharedHitBlocks.values[l] = float64(last.SharedHitBlocks)
+		r.sharedReadBlocks.values[l] = float64(last.SharedReadBlocks)
+	}
+	if entry.Plan != nil {
+		r.rows.values[l] = entry.Plan.Plan.ActualRows
+	}
+}
+
+func (r *Registry) Write(w io.Writer) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.executionTime.write(w)
+	r.planningTime.write(w)
+	r.rows.write(w)
+	r.sharedHitBlocks.write(w)
+	r.sharedReadBlocks.write(w)
+	r.errors.write(w)
+	r.entries.write(w)
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
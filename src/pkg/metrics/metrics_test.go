@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/explain"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/report"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.Observe(&report.Entry{
+		Query:     `query "0"`,
+		Selection: report.SelectionOrdered,
+		Injection: report.InjectionOrTree,
+		ScopeSize: 10,
+		Plan:      &explain.Plan{Plan: explain.Node{ActualRows: 6}},
+		Executions: []report.Execution{
+			{Iteration: 1, PlanningTime: 1.5, ExecutionTime: 3, SharedHitBlocks: 1, SharedReadBlocks: 20},
+			{Iteration: 2, PlanningTime: 0.5, ExecutionTime: 1, SharedHitBlocks: 21, SharedReadBlocks: 0},
+		},
+	})
+	registry.Observe(&report.Entry{
+		Query:     `query "0"`,
+		Selection: report.SelectionRandom,
+		Injection: report.InjectionOrTree,
+		ScopeSize: 10,
+		Error:     "timeout",
+	})
+
+	var sb strings.Builder
+	registry.Write(&sb)
+	output := sb.String()
+	ordered := `query="query \"0\"",scope_size="10",selection="ordered",injection="or-tree",rendering=""`
+	random := `query="query \"0\"",scope_size="10",selection="random",injection="or-tree",rendering=""`
+	assert.Contains(t, output, "# TYPE sacsqlperf_execution_time_seconds histogram\n")
+	assert.Contains(t, output, `sacsqlperf_execution_time_seconds_bucket{`+ordered+`,le="0.001"} 1`+"\n")
+	assert.Contains(t, output, `sacsqlperf_execution_time_seconds_bucket{`+ordered+`,le="0.002"} 1`+"\n")
+	assert.Contains(t, output, `sacsqlperf_execution_time_seconds_bucket{`+ordered+`,le="0.004"} 2`+"\n")
+	assert.Contains(t, output, `sacsqlperf_execution_time_seconds_bucket{`+ordered+`,le="+Inf"} 2`+"\n")
+	assert.Contains(t, output, `sacsqlperf_execution_time_seconds_count{`+ordered+`} 2`+"\n")
+	assert.Contains(t, output, `sacsqlperf_planning_time_seconds_sum{`+ordered+`} 0.002`+"\n")
+	assert.Contains(t, output, `sacsqlperf_rows{`+ordered+`} 6`+"\n")
+	assert.Contains(t, output, `sacsqlperf_shared_hit_blocks{`+ordered+`} 21`+"\n")
+	assert.Contains(t, output, `sacsqlperf_shared_read_blocks{`+ordered+`} 0`+"\n")
+	assert.Contains(t, output, `sacsqlperf_errors_total{`+random+`} 1`+"\n")
+	assert.NotContains(t, output, `sacsqlperf_errors_total{`+ordered+`}`)
+	assert.Contains(t, output, `sacsqlperf_entries_total{`+ordered+`} 1`+"\n")
+	assert.NotContains(t, output, `sacsqlperf_execution_time_seconds_count{`+random+`}`)
+}
@@ -0,0 +1,185 @@
+package params
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+)
+
+// Expander produces the concrete queries of query templates.
+type Expander struct {
+	db  db.DB
+	now time.Time
+}
+
+func NewExpander(db db.DB, now time.Time) *Expander {
+	return &Expander{db: db, now: now}
+}
+
+// ExpandAll replaces every template in the list by its concrete queries,
+// keeping the other queries as they are.
+func (e *Expander) ExpandAll(ctx context.Context, queries []*query.Query) ([]*query.Query, error) {
+	result := make([]*query.Query, 0, len(queries))
+	for _, q := range queries {
+		if !q.IsTemplate() {
+			result = append(result, q)
+			continue
+		}
+		expanded, err := e.Expand(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, expanded...)
+	}
+	return result, nil
+}
+
+// Expand generates the values of every template parameter and binds one
+// concrete query per combination of values.
+func (e *Expander) Expand(ctx context.Context, template *query.Query) ([]*query.Query, error) {
+	parameterNames := make(map[string]struct{}, len(template.Parameters))
+	for _, parameter := range template.Parameters {
+		parameterNames[parameter.Name] = struct{}{}
+	}
+	for _, placeholder := range template.Placeholders() {
+		if _, found := parameterNames[placeholder]; !found {
+			return nil, errors.Errorf("query %q: placeholder %q has no parameter", template.Name, placeholder)
+		}
+	}
+	combinations := [][]query.BoundParameter{{}}
+	for _, parameter := range template.Parameters {
+		values, err := e.generate(ctx, template.Name, parameter)
+		if err != nil {
+			return nil, errors.Wrapf(err, "query %q: could not generate values of parameter %q", template.Name, parameter.Name)
+		}
+		if len(values) == 0 {
+			return nil, errors.Errorf("query %q: no value generated for parameter %q", template.Name, parameter.Name)
+		}
+		next := make([][]query.BoundParameter, 0, len(combinations)*len(values))
+		for _, combination := range combinations {
+			for _, value := range values {
+				extended := make([]query.BoundParameter, len(combination), len(combination)+1)
+				copy(extended, combination)
+				extended = append(extended, query.BoundParameter{Name: parameter.Name, Value: value})
+				next = append(next, extended)
+			}
+		}
+		combinations = next
+	}
+	result := make([]*query.Query, 0, len(combinations))
+	for _, combination := range combinations {
+		concrete, err := template.Bind(combination)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, concrete)
+	}
+	return result, nil
+}
+
+// randomSource is seeded from the template and parameter names so that
+// a given catalog always produces the same queries on the same data.
+func randomSource(templateName string, parameterName string) *rand.Rand {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(templateName + "\x00" + parameterName))
+	return rand.New(rand.NewSource(int64(hash.Sum64())))
+}
+
+func (e *Expander) generate(ctx context.Context, templateName string, parameter query.Parameter) ([]interface{}, error) {
+	generator := parameter.Generator
+	randGen := randomSource(templateName, parameter.Name)
+	switch generator.Kind {
+	case query.GeneratorList:
+		values := make([]interface{}, 0, len(generator.Values))
+		for _, value := range generator.Values {
+			values = append(values, normalizeNumber(value))
+		}
+		return values, nil
+	case query.GeneratorColumn:
+		distinctValues, err := e.distinctValues(ctx, generator.Table, generator.Column)
+		if err != nil {
+			return nil, err
+		}
+		return sample(randGen, distinctValues, generator.Count), nil
+	case query.GeneratorRange:
+		if generator.Max < generator.Min {
+			return nil, errors.Errorf("range max %d is lower than min %d", generator.Max, generator.Min)
+		}
+		values := make([]interface{}, 0, generator.Count)
+		for i := 0; i < generator.Count; i++ {
+			values = append(values, generator.Min+randGen.Int63n(generator.Max-generator.Min+1))
+		}
+		return values, nil
+	case query.GeneratorRelativeTime:
+		values := make([]interface{}, 0, len(generator.Offsets))
+		for _, offset := range generator.Offsets {
+			duration, err := time.ParseDuration(offset)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid time offset %q", offset)
+			}
+			values = append(values, e.now.Add(duration))
+		}
+		return values, nil
+	default:
+		return nil, errors.Errorf("unknown generator kind %q", generator.Kind)
+	}
+}
+
+func (e *Expander) distinctValues(ctx context.Context, table string, column string) ([]interface{}, error) {
+	if e.db == nil {
+		return nil, errors.New("no database connection to sample column values")
+	}
+	qualified := (&query.QualifiedColumn{TableName: table, ColumnName: column}).Identifier()
+	stmt := fmt.Sprintf("select distinct %s from %s where %s is not null", qualified, query.QuoteIdentifier(table), qualified)
+	rows, err := e.db.Query(ctx, stmt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not query distinct values of %s.%s", table, column)
+	}
+	defer rows.Close()
+	values := make([]interface{}, 0)
+	for rows.Next() {
+		rowValues, err := rows.Values()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not read distinct values of %s.%s", table, column)
+		}
+		value := rowValues[0]
+		if uuid, isUUID := value.([16]byte); isUUID {
+			value = fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+		}
+		values = append(values, value)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "Could not read distinct values of %s.%s", table, column)
+	}
+	return values, nil
+}
+
+// sample draws count values without replacement, in a stable order.
+func sample(randGen *rand.Rand, values []interface{}, count int) []interface{} {
+	sorted := make([]interface{}, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return fmt.Sprint(sorted[i]) < fmt.Sprint(sorted[j]) })
+	if count <= 0 || count >= len(sorted) {
+		return sorted
+	}
+	randGen.Shuffle(len(sorted), func(i, j int) { sorted[i], sorted[j] = sorted[j], sorted[i] })
+	return sorted[:count]
+}
+
+// normalizeNumber turns the integral numbers decoded from JSON as floating
+// point values into integers.
+func normalizeNumber(value interface{}) interface{} {
+	number, isFloat := value.(float64)
+	if !isFloat || number != math.Trunc(number) || math.Abs(number) > math.MaxInt64 {
+		return value
+	}
+	return int64(number)
+}
@@ -0,0 +1,117 @@
+package params
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func alertsTemplate(parameters ...query.Parameter) *query.Query {
+	return &query.Query{
+		Name:             "alerts-count",
+		Statement:        "select",
+		StatementTargets: []query.Target{query.Raw("count(*)")},
+		TargetTables:     []string{"alerts"},
+		WhereClause: &query.WcAnd{
+			Operands: []query.WhereClausePart{
+				&query.QualifiedColumn{TableName: "alerts", ColumnName: "Policy_Severity", Placeholder: "severity"},
+				&query.QualifiedColumn{TableName: "alerts", ColumnName: "Time", Placeholder: "since"},
+			},
+		},
+		Parameters: parameters,
+	}
+}
+
+func TestExpand(t *testing.T) {
+	now := time.Date(2024, 11, 18, 12, 0, 0, 0, time.UTC)
+	template := alertsTemplate(
+		query.Parameter{Name: "severity", Generator: query.Generator{Kind: query.GeneratorList, Values: []interface{}{float64(3), float64(4)}}},
+		query.Parameter{Name: "since", Generator: query.Generator{Kind: query.GeneratorRelativeTime, Offsets: []string{"-24h", "-168h"}}},
+	)
+	queries, err := NewExpander(nil, now).Expand(context.Background(), template)
+	require.NoError(t, err)
+	names := make([]string, 0, len(queries))
+	for _, q := range queries {
+		names = append(names, q.Name)
+		assert.Equal(t, "alerts-count", q.Template)
+		assert.False(t, q.IsTemplate())
+	}
+	assert.Equal(t, []string{
+		"alerts-count[severity=3,since=2024-11-17T12:00:00Z]",
+		"alerts-count[severity=3,since=2024-11-11T12:00:00Z]",
+		"alerts-count[severity=4,since=2024-11-17T12:00:00Z]",
+		"alerts-count[severity=4,since=2024-11-11T12:00:00Z]",
+	}, names)
+	stmt, bindValues := queries[1].ForExecution()
+	assert.Equal(t, "select count(*) from alerts where ( alerts.Policy_Severity = $1 and alerts.Time = $2 )", stmt)
+	assert.Equal(t, []interface{}{int64(3), now.Add(-168 * time.Hour)}, bindValues)
+	assert.Equal(t, "severity", template.WhereClause.(*query.WcAnd).Operands[0].(*query.QualifiedColumn).Placeholder)
+}
+
+func TestExpandRange(t *testing.T) {
+	template := alertsTemplate(
+		query.Parameter{Name: "severity", Generator: query.Generator{Kind: query.GeneratorRange, Min: 1, Max: 4, Count: 5}},
+		query.Parameter{Name: "since", Generator: query.Generator{Kind: query.GeneratorList, Values: []interface{}{"2024-01-01"}}},
+	)
+	expander := NewExpander(nil, time.Now())
+	queries, err := expander.Expand(context.Background(), template)
+	require.NoError(t, err)
+	require.Len(t, queries, 5)
+	for _, q := range queries {
+		_, bindValues := q.ForExecution()
+		severity := bindValues[0].(int64)
+		assert.GreaterOrEqual(t, severity, int64(1))
+		assert.LessOrEqual(t, severity, int64(4))
+	}
+	again, err := expander.Expand(context.Background(), template)
+	require.NoError(t, err)
+	assert.Equal(t, queries, again)
+}
+
+func TestExpandErrors(t *testing.T) {
+	expander := NewExpander(nil, time.Now())
+	testCases := map[string]*query.Query{
+		"missing parameter": alertsTemplate(
+			query.Parameter{Name: "severity", Generator: query.Generator{Kind: query.GeneratorList, Values: []interface{}{1}}},
+		),
+		"unknown kind": alertsTemplate(
+			query.Parameter{Name: "severity", Generator: query.Generator{Kind: "fibonacci"}},
+			query.Parameter{Name: "since", Generator: query.Generator{Kind: query.GeneratorList, Values: []interface{}{1}}},
+		),
+		"no values": alertsTemplate(
+			query.Parameter{Name: "severity", Generator: query.Generator{Kind: query.GeneratorList}},
+			query.Parameter{Name: "since", Generator: query.Generator{Kind: query.GeneratorList, Values: []interface{}{1}}},
+		),
+		"invalid range": alertsTemplate(
+			query.Parameter{Name: "severity", Generator: query.Generator{Kind: query.GeneratorRange, Min: 4, Max: 1, Count: 1}},
+			query.Parameter{Name: "since", Generator: query.Generator{Kind: query.GeneratorList, Values: []interface{}{1}}},
+		),
+		"invalid offset": alertsTemplate(
+			query.Parameter{Name: "severity", Generator: query.Generator{Kind: query.GeneratorList, Values: []interface{}{1}}},
+			query.Parameter{Name: "since", Generator: query.Generator{Kind: query.GeneratorRelativeTime, Offsets: []string{"yesterday"}}},
+		),
+		"column without database": alertsTemplate(
+			query.Parameter{Name: "severity", Generator: query.Generator{Kind: query.GeneratorColumn, Table: "alerts", Column: "Policy_Severity"}},
+			query.Parameter{Name: "since", Generator: query.Generator{Kind: query.GeneratorList, Values: []interface{}{1}}},
+		),
+	}
+	for name, template := range testCases {
+		t.Run(name, func(it *testing.T) {
+			_, err := expander.Expand(context.Background(), template)
+			assert.Error(it, err)
+		})
+	}
+}
+
+func TestSample(t *testing.T) {
+	values := []interface{}{"e", "b", "a", "d", "c"}
+	assert.Equal(t, []interface{}{"a", "b", "c", "d", "e"}, sample(randomSource("t", "p"), values, 0))
+	sampled := sample(randomSource("t", "p"), values, 3)
+	assert.Len(t, sampled, 3)
+	assert.Equal(t, sampled, sample(randomSource("t", "p"), values, 3))
+	assert.Equal(t, []interface{}{"e", "b", "a", "d", "c"}, values)
+}
@@ -0,0 +1,193 @@
+package prepared
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/explain"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+)
+
+const (
+	statementName = "sacsqlperf_prepared"
+
+	planCacheAuto           = "auto"
+	planCacheForceCustom    = "force_custom_plan"
+	planCacheForceGeneric   = "force_generic_plan"
+	genericPlansStatement   = "select generic_plans from pg_prepared_statements where name = $1"
+	preparedExistsStatement = "select count(*) from pg_prepared_statements where name = $1"
+)
+
+type Execution struct {
+	Iteration     int     `json:"iteration"`
+	Generic       bool    `json:"generic"`
+	PlanningTime  float64 `json:"planningTime"`
+	ExecutionTime float64 `json:"executionTime"`
+}
+
+type Analysis struct {
+	Executions []Execution `json:"executions"`
+	// GenericPlanChosenAt is the first iteration (1-based) that used the
+	// generic plan when plan_cache_mode is auto, 0 if it was never used.
+	GenericPlanChosenAt int           `json:"genericPlanChosenAt"`
+	CustomPlan          *explain.Plan `json:"customPlan"`
+	GenericPlan         *explain.Plan `json:"genericPlan"`
+}
+
+// Analyze prepares the statement rendered from the request and runs it the
+// given number of times with the default plan cache mode, recording whether
+// the server switched to the generic plan. It then captures the plans forced
+// by the custom and generic plan cache modes for comparison.
+func Analyze(ctx context.Context, db db.DB, request *query.Query, executions int) (*Analysis, error) {
+	stmt, bindValues := request.ForExecution()
+	executeStatement, err := executeStatement(bindValues)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not begin transaction")
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Prepared statements are not transactional, a failed analysis may have
+	// left one behind on the pooled connection.
+	if err = deallocateLeftover(ctx, tx); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, fmt.Sprintf("prepare %s as %s", statementName, stmt))
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not prepare statement")
+	}
+	defer func() { _, _ = tx.Exec(ctx, fmt.Sprintf("deallocate %s", statementName)) }()
+
+	analysis := &Analysis{Executions: make([]Execution, 0, executions)}
+	if err = setPlanCacheMode(ctx, tx, planCacheAuto); err != nil {
+		return nil, err
+	}
+	previousGenericPlans, err := genericPlanCount(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	for iteration := 1; iteration <= executions; iteration++ {
+		plan, err := explainExecute(ctx, tx, executeStatement)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not run execution %d", iteration)
+		}
+		genericPlans, err := genericPlanCount(ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+		generic := genericPlans > previousGenericPlans
+		previousGenericPlans = genericPlans
+		if generic && analysis.GenericPlanChosenAt == 0 {
+			analysis.GenericPlanChosenAt = iteration
+		}
+		analysis.Executions = append(analysis.Executions, Execution{
+			Iteration:     iteration,
+			Generic:       generic,
+			PlanningTime:  plan.PlanningTime,
+			ExecutionTime: plan.ExecutionTime,
+		})
+	}
+
+	if err = setPlanCacheMode(ctx, tx, planCacheForceCustom); err != nil {
+		return nil, err
+	}
+	if analysis.CustomPlan, err = explainExecute(ctx, tx, executeStatement); err != nil {
+		return nil, errors.Wrap(err, "Could not get custom plan")
+	}
+	if err = setPlanCacheMode(ctx, tx, planCacheForceGeneric); err != nil {
+		return nil, err
+	}
+	if analysis.GenericPlan, err = explainExecute(ctx, tx, executeStatement); err != nil {
+		return nil, errors.Wrap(err, "Could not get generic plan")
+	}
+	return analysis, nil
+}
+
+// Check asks the server to parse and plan the statement by preparing it,
+// without executing it.
+func Check(ctx context.Context, db db.DB, stmt string) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Could not begin transaction")
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err = deallocateLeftover(ctx, tx); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, fmt.Sprintf("prepare %s as %s", statementName, stmt))
+	if err != nil {
+		return errors.Wrap(err, "Could not prepare statement")
+	}
+	_, err = tx.Exec(ctx, fmt.Sprintf("deallocate %s", statementName))
+	if err != nil {
+		return errors.Wrap(err, "Could not deallocate prepared statement")
+	}
+	return nil
+}
+
+// executeStatement renders the execute command for the prepared statement.
+// Utility statements do not accept bind parameters, the values are inlined.
+func executeStatement(bindValues []interface{}) (string, error) {
+	if len(bindValues) == 0 {
+		return fmt.Sprintf("execute %s", statementName), nil
+	}
+	literals := make([]string, 0, len(bindValues))
+	for _, value := range bindValues {
+		literal, err := query.QuoteLiteral(value)
+		if err != nil {
+			return "", errors.Wrap(err, "Could not render execute parameters")
+		}
+		literals = append(literals, literal)
+	}
+	return fmt.Sprintf("execute %s(%s)", statementName, strings.Join(literals, ", ")), nil
+}
+
+func explainExecute(ctx context.Context, tx pgx.Tx, executeStatement string) (*explain.Plan, error) {
+	var raw string
+	err := tx.QueryRow(ctx, explain.Statement(executeStatement)).Scan(&raw)
+	if err != nil {
+		return nil, err
+	}
+	return explain.Parse([]byte(raw))
+}
+
+func setPlanCacheMode(ctx context.Context, tx pgx.Tx, mode string) error {
+	_, err := tx.Exec(ctx, fmt.Sprintf("set local plan_cache_mode = %s", mode))
+	if err != nil {
+		return errors.Wrapf(err, "Could not set plan_cache_mode to %s", mode)
+	}
+	return nil
+}
+
+func genericPlanCount(ctx context.Context, tx pgx.Tx) (int64, error) {
+	var genericPlans int64
+	err := tx.QueryRow(ctx, genericPlansStatement, statementName).Scan(&genericPlans)
+	if err != nil {
+		return 0, errors.Wrap(err, "Could not read prepared statement counters")
+	}
+	return genericPlans, nil
+}
+
+func deallocateLeftover(ctx context.Context, tx pgx.Tx) error {
+	var count int
+	err := tx.QueryRow(ctx, preparedExistsStatement, statementName).Scan(&count)
+	if err != nil {
+		return errors.Wrap(err, "Could not look up prepared statements")
+	}
+	if count == 0 {
+		return nil
+	}
+	_, err = tx.Exec(ctx, fmt.Sprintf("deallocate %s", statementName))
+	if err != nil {
+		return errors.Wrap(err, "Could not deallocate prepared statement")
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package prepared
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db/dbtest"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const samplePlan = `[{"Plan": {"Node Type": "Result"}, "Planning Time": 0.1, "Execution Time": 0.2}]`
+
+func TestAnalyze(t *testing.T) {
+	fake := dbtest.New().
+		On(preparedExistsStatement, dbtest.Result{Rows: [][]any{{1}}}).
+		On(genericPlansStatement, dbtest.Result{Rows: [][]any{{int64(0)}}}).
+		On("explain", dbtest.Result{Rows: [][]any{{samplePlan}}})
+	request := &query.Query{
+		Statement:        "select",
+		StatementTargets: []query.Target{query.Raw("count(*)")},
+		TargetTables:     []string{"alerts"},
+		WhereClause:      &query.QualifiedColumn{TableName: "alerts", ColumnName: "Namespace", Value: "it's"},
+	}
+
+	analysis, err := Analyze(context.Background(), fake, request, 2)
+	require.NoError(t, err)
+	assert.Len(t, analysis.Executions, 2)
+	assert.Zero(t, analysis.GenericPlanChosenAt)
+	assert.Equal(t, 0.2, analysis.GenericPlan.ExecutionTime)
+
+	statements := fake.Statements()
+	assert.Equal(t, dbtest.StatementBegin, statements[0])
+	assert.Equal(t, "deallocate sacsqlperf_prepared", statements[2])
+	assert.Equal(t, "prepare sacsqlperf_prepared as select count(*) from alerts where alerts.Namespace = $1", statements[3])
+	assert.Contains(t, statements, "explain (verbose, analyze, buffers, settings, format json) execute sacsqlperf_prepared('it''s')")
+	assert.Contains(t, statements, "set local plan_cache_mode = force_generic_plan")
+	assert.Equal(t, dbtest.StatementRollback, statements[len(statements)-1])
+}
+
+func TestCheck(t *testing.T) {
+	fake := dbtest.New().On(preparedExistsStatement, dbtest.Result{Rows: [][]any{{0}}})
+	require.NoError(t, Check(context.Background(), fake, "select count(*) from alerts where alerts.State = $1"))
+	assert.Equal(t, []string{
+		dbtest.StatementBegin,
+		preparedExistsStatement,
+		"prepare sacsqlperf_prepared as select count(*) from alerts where alerts.State = $1",
+		"deallocate sacsqlperf_prepared",
+		dbtest.StatementRollback,
+	}, fake.Statements())
+
+	failure := errors.New(`syntax error at or near "group"`)
+	fake = dbtest.New().
+		On(preparedExistsStatement, dbtest.Result{Rows: [][]any{{0}}}).
+		On("prepare", dbtest.Result{Err: failure})
+	err := Check(context.Background(), fake, "select * from alerts order by alerts.Id group by alerts.Id")
+	assert.ErrorIs(t, err, failure)
+	assert.NotContains(t, fake.Statements(), "deallocate sacsqlperf_prepared")
+}
+
+func TestExecuteStatement(t *testing.T) {
+	statement, err := executeStatement([]interface{}{[]string{"c1", "c2"}, 3})
+	require.NoError(t, err)
+	assert.Equal(t, `execute sacsqlperf_prepared('{"c1","c2"}', 3)`, statement)
+
+	_, err = executeStatement([]interface{}{[]int{1}})
+	assert.Error(t, err)
+}
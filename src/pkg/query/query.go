@@ -2,66 +2,120 @@ package query
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 )
 
 type QualifiedColumn struct {
-	TableName  string
-	ColumnName string
-	Value      interface{}
+	TableName  string      `json:"table"`
+	ColumnName string      `json:"column"`
+	Value      interface{} `json:"value,omitempty"`
+	// Placeholder names the template parameter providing the value.
+	Placeholder string `json:"placeholder,omitempty"`
+	// Type is the Postgres type the value is cast to, e.g. uuid, the server
+	// infers it when empty.
+	Type string `json:"type,omitempty"`
 }
 
 type InnerJoin struct {
-	Left  QualifiedColumn
-	Right QualifiedColumn
+	Left  QualifiedColumn `json:"left"`
+	Right QualifiedColumn `json:"right"`
 }
 
 type OrderColumn struct {
-	Column   QualifiedColumn
-	Reversed bool
+	Column   QualifiedColumn `json:"column"`
+	Reversed bool            `json:"reversed,omitempty"`
 }
 
 type Pagination struct {
-	Limit  int
-	Offset int
+	Limit  int `json:"limit,omitempty"`
+	Offset int `json:"offset,omitempty"`
 }
 
 type Query struct {
-	Statement            string
-	StatementTargets     []string
-	TargetTables         []string
-	InnerJoins           []InnerJoin
-	WhereClause          WhereClausePart
-	OrderBy              []OrderColumn
-	GroupBy              []QualifiedColumn
-	QueryPagination      *Pagination
-	ScopeLevel           string
-	ScopeTable           string
-	ScopeClusterColumn   string
-	ScopeNamespaceColumn string
+	// Name identifies the query in the command line and the reports.
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Origin is the Central API or page issuing the query.
+	Origin string `json:"origin,omitempty"`
+	// Parameters make the query a template, expanded in one concrete query
+	// per combination of generated parameter values.
+	Parameters []Parameter `json:"parameters,omitempty"`
+	// Template is the name of the template a concrete query was expanded from.
+	Template string `json:"template,omitempty"`
+
+	Statement            string            `json:"statement"`
+	StatementTargets     []Target          `json:"statementTargets,omitempty"`
+	TargetTables         []string          `json:"targetTables"`
+	InnerJoins           []InnerJoin       `json:"innerJoins,omitempty"`
+	WhereClause          WhereClausePart   `json:"whereClause,omitempty"`
+	OrderBy              []OrderColumn     `json:"orderBy,omitempty"`
+	GroupBy              []QualifiedColumn `json:"groupBy,omitempty"`
+	Having               WhereClausePart   `json:"having,omitempty"`
+	QueryPagination      *Pagination       `json:"pagination,omitempty"`
+	ScopeLevel           string            `json:"scopeLevel,omitempty"`
+	ScopeTable           string            `json:"scopeTable,omitempty"`
+	ScopeClusterColumn   string            `json:"scopeClusterColumn,omitempty"`
+	ScopeNamespaceColumn string            `json:"scopeNamespaceColumn,omitempty"`
+	// ScopeClusterType and ScopeNamespaceType are the Postgres types the
+	// values of the SAC filter are cast to.
+	ScopeClusterType   string `json:"scopeClusterType,omitempty"`
+	ScopeNamespaceType string `json:"scopeNamespaceType,omitempty"`
+	// ScopeJoins is the join path from the target tables to the scope table,
+	// for the queries that do not join the scope table themselves.
+	ScopeJoins []InnerJoin `json:"scopeJoins,omitempty"`
+
+	// Rendering is how ForExecution renders the statement.
+	Rendering RenderOptions `json:"-"`
+}
+
+// RenderOptions select a rendering of the statement, the zero value being
+// the default one.
+type RenderOptions struct {
+	// OmitCasts renders the bind markers of typed values without their
+	// type cast, letting the server infer the types.
+	OmitCasts bool
+	// InlineLiterals renders the bind values as literals in the statement,
+	// for the planner to see them as constants.
+	InlineLiterals bool
 }
 
+// WithRendering returns a copy of the query rendered with the options.
+func (q *Query) WithRendering(options RenderOptions) *Query {
+	result := *q
+	result.Rendering = options
+	return &result
+}
+
+// ForExecution renders the statement with the rendering options of the
+// query, and returns it with its bind values.
 func (q *Query) ForExecution() (string, []interface{}) {
+	return q.Render(q.Rendering)
+}
+
+// Render renders the statement with the given options, and returns it with
+// its bind values.
+func (q *Query) Render(options RenderOptions) (string, []interface{}) {
 	params := make([]interface{}, 0)
 	var qb strings.Builder
 	qb.WriteString(q.Statement)
-	if len(q.StatementTargets) > 0 {
+	for ix, target := range q.StatementTargets {
+		if ix > 0 {
+			qb.WriteString(",")
+		}
 		qb.WriteString(" ")
-		qb.WriteString(strings.Join(q.StatementTargets, ", "))
+		qb.WriteString(target.render())
 	}
 	qb.WriteString(" from ")
-	qb.WriteString(strings.Join(q.TargetTables, " "))
+	for ix, table := range q.TargetTables {
+		if ix > 0 {
+			qb.WriteString(", ")
+		}
+		qb.WriteString(QuoteIdentifier(table))
+	}
 	for _, join := range q.InnerJoins {
-		qb.WriteString(
-			fmt.Sprintf(
-				" inner join %s on %s.%s = %s.%s",
-				join.Right.TableName,
-				join.Left.TableName,
-				join.Left.ColumnName,
-				join.Right.TableName,
-				join.Right.ColumnName,
-			),
-		)
+		qb.WriteString(renderJoin(join))
 	}
 	if q.WhereClause != nil {
 		whereClause, bindValues := q.WhereClause.AsWhereClausePart()
@@ -69,46 +123,147 @@ func (q *Query) ForExecution() (string, []interface{}) {
 		qb.WriteString(whereClause)
 		params = append(params, bindValues...)
 	}
+	if len(q.GroupBy) > 0 {
+		qb.WriteString(" group by ")
+		for ix, column := range q.GroupBy {
+			if ix > 0 {
+				qb.WriteString(", ")
+			}
+			qb.WriteString(column.Identifier())
+		}
+	}
+	if q.Having != nil {
+		having, bindValues := q.Having.AsWhereClausePart()
+		qb.WriteString(" having ")
+		qb.WriteString(having)
+		params = append(params, bindValues...)
+	}
 	if len(q.OrderBy) > 0 {
 		qb.WriteString(" order by ")
 		for ix, order := range q.OrderBy {
 			if ix > 0 {
 				qb.WriteString(", ")
 			}
-			qb.WriteString(fmt.Sprintf("%s.%s", order.Column.TableName, order.Column.ColumnName))
+			qb.WriteString(order.Column.Identifier())
 			if order.Reversed {
 				qb.WriteString(" desc")
 			}
 		}
 	}
-	if len(q.GroupBy) > 0 {
-		qb.WriteString(" group by ")
-		for ix, column := range q.GroupBy {
-			if ix > 0 {
-				qb.WriteString(", ")
-			}
-			qb.WriteString(fmt.Sprintf("%s.%s", column.TableName, column.ColumnName))
-		}
-	}
 	if q.QueryPagination != nil {
-		if q.QueryPagination.Offset > 0 {
-			qb.WriteString(fmt.Sprintf(" offset %d", q.QueryPagination.Offset))
-		}
 		if q.QueryPagination.Limit > 0 {
 			qb.WriteString(fmt.Sprintf(" limit %d", q.QueryPagination.Limit))
 		}
+		if q.QueryPagination.Offset > 0 {
+			qb.WriteString(fmt.Sprintf(" offset %d", q.QueryPagination.Offset))
+		}
 	}
-	return enumerateBindValues(qb.String()), params
+	return enumerateBindValues(qb.String(), params, options)
+}
+
+func renderJoin(join InnerJoin) string {
+	return fmt.Sprintf(
+		" inner join %s on %s = %s",
+		QuoteIdentifier(join.Right.TableName),
+		join.Left.Identifier(),
+		join.Right.Identifier(),
+	)
 }
 
-func enumerateBindValues(statement string) string {
+// enumerateBindValues numbers the bind markers of the statement, casting
+// the typed values unless omitted, and returns the statement with the bare
+// bind values. When inlining literals, the values are rendered in the
+// statement instead, except the ones of types without a literal form.
+func enumerateBindValues(statement string, values []interface{}, options RenderOptions) (string, []interface{}) {
 	parts := strings.Split(statement, "$$")
+	bindValues := make([]interface{}, 0, len(values))
 	var result strings.Builder
 	for ix, part := range parts {
-		if ix > 0 {
-			result.WriteString(fmt.Sprintf("$%d", ix))
+		// Markers without value come from the names of an unvalidated
+		// query, ValidateIdentifier rejecting them; they are left as is.
+		if ix > len(values) {
+			result.WriteString("$$")
+		} else if ix > 0 {
+			value := values[ix-1]
+			cast := ""
+			if typed, isTyped := value.(TypedValue); isTyped {
+				if !options.OmitCasts {
+					cast = "::" + typed.Type
+				}
+				value = typed.Value
+			}
+			rendered := ""
+			if options.InlineLiterals {
+				if literal, err := QuoteLiteral(value); err == nil {
+					rendered = literal
+				}
+			}
+			if rendered == "" {
+				bindValues = append(bindValues, value)
+				rendered = fmt.Sprintf("$%d", len(bindValues))
+			}
+			result.WriteString(rendered)
+			result.WriteString(cast)
 		}
 		result.WriteString(part)
 	}
-	return result.String()
+	return result.String(), bindValues
+}
+
+// Typed tells whether the statement has bind values cast to a type, when
+// restricted to a scope.
+func (q *Query) Typed() bool {
+	if (q.ScopeLevel == "cluster" || q.ScopeLevel == "namespace") && q.ScopeClusterType != "" {
+		return true
+	}
+	if q.ScopeLevel == "namespace" && q.ScopeNamespaceType != "" {
+		return true
+	}
+	return typed(q.WhereClause) || typed(q.Having)
+}
+
+// Paginated tells whether the statement returns a page of its rows, which
+// depends on the plan unless the rows are in a total order.
+func (q *Query) Paginated() bool {
+	return q.QueryPagination != nil && (q.QueryPagination.Limit > 0 || q.QueryPagination.Offset > 0)
+}
+
+// Tables lists the tables referenced by the query, in order of appearance.
+func (q *Query) Tables() []string {
+	tables := make([]string, 0, len(q.TargetTables)+len(q.InnerJoins)+1)
+	seen := make(map[string]struct{}, cap(tables))
+	add := func(table string) {
+		if _, found := seen[table]; found || table == "" {
+			return
+		}
+		seen[table] = struct{}{}
+		tables = append(tables, table)
+	}
+	for _, table := range q.TargetTables {
+		add(table)
+	}
+	for _, join := range q.InnerJoins {
+		add(join.Left.TableName)
+		add(join.Right.TableName)
+	}
+	for _, join := range q.ScopeJoins {
+		add(join.Left.TableName)
+		add(join.Right.TableName)
+	}
+	add(q.ScopeTable)
+	return tables
+}
+
+// ReachesScopeTable tells whether the scope table is one of the target or
+// joined tables of the statement.
+func (q *Query) ReachesScopeTable() bool {
+	if slices.Contains(q.TargetTables, q.ScopeTable) {
+		return true
+	}
+	for _, join := range q.InnerJoins {
+		if join.Left.TableName == q.ScopeTable || join.Right.TableName == q.ScopeTable {
+			return true
+		}
+	}
+	return false
 }
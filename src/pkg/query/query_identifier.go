@@ -0,0 +1,193 @@
+package query
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxIdentifierLength is the length Postgres truncates identifiers to.
+const maxIdentifierLength = 63
+
+var simpleIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedKeywords are the Postgres keywords that cannot be used as table or
+// column names without quotes.
+var reservedKeywords = map[string]struct{}{}
+
+func init() {
+	for _, keyword := range strings.Fields(`all analyse analyze and any array as asc asymmetric
+both case cast check collate column constraint create current_catalog current_date
+current_role current_time current_timestamp current_user default deferrable desc
+distinct do else end except false fetch for foreign from grant group having in
+initially intersect into lateral leading limit localtime localtimestamp not null
+offset on only or order placing primary references returning select session_user
+some symmetric system_user table then to trailing true union unique user using
+variadic when where window with`) {
+		reservedKeywords[keyword] = struct{}{}
+	}
+}
+
+// QuoteIdentifier renders a table or column name for a statement. Simple
+// names are left unquoted, Postgres folding them to lower case. Reserved
+// keywords are quoted in lower case, to designate the same object, and the
+// other names are quoted as is.
+func QuoteIdentifier(name string) string {
+	if simpleIdentifier.MatchString(name) {
+		lower := strings.ToLower(name)
+		if _, reserved := reservedKeywords[lower]; !reserved {
+			return name
+		}
+		name = lower
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// CatalogName returns the name the Postgres catalogs hold for the table or
+// column rendered by QuoteIdentifier.
+func CatalogName(name string) string {
+	if simpleIdentifier.MatchString(name) {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// ValidateIdentifier rejects the names that cannot designate a table or a
+// column once quoted, and the ones containing a $, which could be taken for
+// the bind markers of the rendered statement.
+func ValidateIdentifier(name string) error {
+	if name == "" {
+		return errors.New("Empty identifier")
+	}
+	if strings.ContainsRune(name, 0) {
+		return errors.Errorf("Identifier %q contains a null character", name)
+	}
+	if strings.ContainsRune(name, '$') {
+		return errors.Errorf("Identifier %q contains a $", name)
+	}
+	if len(name) > maxIdentifierLength {
+		return errors.Errorf("Identifier %q is longer than %d bytes", name, maxIdentifierLength)
+	}
+	return nil
+}
+
+// Identifier renders the column qualified by its table, when it has one.
+func (qc *QualifiedColumn) Identifier() string {
+	if qc.TableName == "" {
+		return QuoteIdentifier(qc.ColumnName)
+	}
+	return QuoteIdentifier(qc.TableName) + "." + QuoteIdentifier(qc.ColumnName)
+}
+
+// RawExpression is SQL rendered as is in a statement, such as an aggregate
+// in the select list. It is not parsed, only checked for what could end the
+// expression early: statement separators, comments, bind markers and
+// unbalanced quotes or parentheses.
+type RawExpression string
+
+func (e RawExpression) Validate() error {
+	if strings.TrimSpace(string(e)) == "" {
+		return errors.New("Empty expression")
+	}
+	var quote rune
+	depth := 0
+	for ix, c := range string(e) {
+		next := ""
+		if ix+1 < len(e) {
+			next = string(e[ix+1])
+		}
+		switch {
+		case c == 0 || c == '\\' || c == '$':
+			return errors.Errorf("Expression %q contains %q", e, c)
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ';':
+			return errors.Errorf("Expression %q contains a statement separator", e)
+		case c == '-' && next == "-", c == '/' && next == "*":
+			return errors.Errorf("Expression %q contains a comment", e)
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth < 0 {
+				return errors.Errorf("Expression %q has unbalanced parentheses", e)
+			}
+		}
+	}
+	if quote != 0 {
+		return errors.Errorf("Expression %q has an unterminated quote", e)
+	}
+	if depth != 0 {
+		return errors.Errorf("Expression %q has unbalanced parentheses", e)
+	}
+	return nil
+}
+
+// Target is an item of the select list, either a column or a raw
+// expression, with an optional alias.
+type Target struct {
+	Column     *QualifiedColumn `json:"column,omitempty"`
+	Expression RawExpression    `json:"expression,omitempty"`
+	Alias      string           `json:"alias,omitempty"`
+}
+
+// Raw returns the target of the raw expression.
+func Raw(expression string) Target {
+	return Target{Expression: RawExpression(expression)}
+}
+
+func (t Target) render() string {
+	rendered := string(t.Expression)
+	if t.Column != nil {
+		rendered = t.Column.Identifier()
+	}
+	if t.Alias != "" {
+		rendered += " as " + QuoteIdentifier(t.Alias)
+	}
+	return rendered
+}
+
+// Validate checks that the target is one column or one expression, with
+// valid names.
+func (t Target) Validate() error {
+	if (t.Column == nil) == (t.Expression == "") {
+		return errors.New("Target must have exactly one of column, expression")
+	}
+	if t.Column != nil {
+		if err := validateColumn(t.Column); err != nil {
+			return err
+		}
+	} else if err := t.Expression.Validate(); err != nil {
+		return err
+	}
+	if t.Alias != "" {
+		return ValidateIdentifier(t.Alias)
+	}
+	return nil
+}
+
+type targetFields Target
+
+// MarshalJSON renders the targets holding only an expression as a string.
+func (t Target) MarshalJSON() ([]byte, error) {
+	if t.Column == nil && t.Alias == "" {
+		return json.Marshal(string(t.Expression))
+	}
+	return json.Marshal(targetFields(t))
+}
+
+// UnmarshalJSON reads a string as a raw expression target.
+func (t *Target) UnmarshalJSON(data []byte) error {
+	var expression string
+	if err := json.Unmarshal(data, &expression); err == nil {
+		*t = Raw(expression)
+		return nil
+	}
+	return json.Unmarshal(data, (*targetFields)(t))
+}
@@ -0,0 +1,89 @@
+package query
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	for name, expected := range map[string]string{
+		"alerts":          "alerts",
+		"ClusterId":       "ClusterId",
+		"_private2":       "_private2",
+		"order":           `"order"`,
+		"User":            `"user"`,
+		"Image Sha":       `"Image Sha"`,
+		"2fa":             `"2fa"`,
+		"alerts.State":    `"alerts.State"`,
+		`x" or 1=1 --`:    `"x"" or 1=1 --"`,
+		"déploiements":    `"déploiements"`,
+		"deployments$old": `"deployments$old"`,
+	} {
+		assert.Equal(t, expected, QuoteIdentifier(name), name)
+	}
+	assert.Equal(t, "clusterid", CatalogName("ClusterId"))
+	assert.Equal(t, "order", CatalogName("Order"))
+	assert.Equal(t, "Image Sha", CatalogName("Image Sha"))
+}
+
+func TestValidateIdentifier(t *testing.T) {
+	assert.NoError(t, ValidateIdentifier("Image Sha"))
+	assert.Error(t, ValidateIdentifier(""))
+	assert.Error(t, ValidateIdentifier("alerts\x00"))
+	assert.Error(t, ValidateIdentifier("a$$b"))
+	assert.Error(t, ValidateIdentifier(strings.Repeat("a", 64)))
+}
+
+func TestRawExpressionValidate(t *testing.T) {
+	for _, expression := range []RawExpression{
+		"count(*)",
+		"distinct(images.Id)",
+		"coalesce(max(alerts.Time), now() - interval '1 day')",
+		`count("weird;name")`,
+		"'it''s'",
+	} {
+		assert.NoError(t, expression.Validate(), expression)
+	}
+	for _, expression := range []RawExpression{
+		"",
+		"1; drop table alerts",
+		"count(*) -- comment",
+		"count(*) /* comment */",
+		"count((*)",
+		"count(*))",
+		"'unterminated",
+		`"unterminated`,
+		"$1",
+		"$$",
+		`E'\''`,
+	} {
+		assert.Error(t, expression.Validate(), expression)
+	}
+}
+
+func TestTargetJSON(t *testing.T) {
+	targets := []Target{
+		Raw("count(*)"),
+		{Expression: "distinct(images.Id)", Alias: "Image_Sha"},
+		{Column: &QualifiedColumn{TableName: "images", ColumnName: "RiskScore"}, Alias: "image risk"},
+	}
+	data, err := json.Marshal(targets)
+	require.NoError(t, err)
+	assert.JSONEq(
+		t,
+		`["count(*)", {"expression": "distinct(images.Id)", "alias": "Image_Sha"},
+		{"column": {"table": "images", "column": "RiskScore"}, "alias": "image risk"}]`,
+		string(data),
+	)
+	decoded := make([]Target, 0)
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, targets, decoded)
+
+	q := &Query{Statement: "select", StatementTargets: targets, TargetTables: []string{"images"}}
+	stmt, _ := q.ForExecution()
+	assert.Equal(t, `select count(*), distinct(images.Id) as Image_Sha, images.RiskScore as "image risk" from images`, stmt)
+}
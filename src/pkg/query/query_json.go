@@ -0,0 +1,178 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// whereClauseJSON is the serialized form of a where clause part, exactly one
+// of its fields is set.
+type whereClauseJSON struct {
+	And       []json.RawMessage `json:"and,omitempty"`
+	Or        []json.RawMessage `json:"or,omitempty"`
+	Column    *QualifiedColumn  `json:"column,omitempty"`
+	Exists    *existsJSON       `json:"exists,omitempty"`
+	Aggregate *WcAggregate      `json:"aggregate,omitempty"`
+}
+
+type existsJSON struct {
+	Joins []InnerJoin     `json:"joins"`
+	Where json.RawMessage `json:"where,omitempty"`
+}
+
+func marshalWhereClause(part WhereClausePart) (json.RawMessage, error) {
+	if part == nil {
+		return nil, nil
+	}
+	var encoded whereClauseJSON
+	var operands []WhereClausePart
+	switch p := part.(type) {
+	case *QualifiedColumn:
+		encoded.Column = p
+	case *WcAggregate:
+		encoded.Aggregate = p
+	case *WcAnd:
+		operands = p.Operands
+	case *WcOr:
+		operands = p.Operands
+	case *WcExists:
+		condition, err := marshalWhereClause(p.Condition)
+		if err != nil {
+			return nil, err
+		}
+		encoded.Exists = &existsJSON{Joins: p.Joins, Where: condition}
+		return json.Marshal(encoded)
+	default:
+		return nil, errors.Errorf("Unsupported where clause part %T", part)
+	}
+	encodedOperands := make([]json.RawMessage, 0, len(operands))
+	for _, operand := range operands {
+		encodedOperand, err := marshalWhereClause(operand)
+		if err != nil {
+			return nil, err
+		}
+		encodedOperands = append(encodedOperands, encodedOperand)
+	}
+	switch part.(type) {
+	case *WcAnd:
+		encoded.And = encodedOperands
+	case *WcOr:
+		encoded.Or = encodedOperands
+	}
+	return json.Marshal(encoded)
+}
+
+func unmarshalWhereClause(data json.RawMessage) (WhereClausePart, error) {
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil, nil
+	}
+	var decoded whereClauseJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	set := 0
+	for _, isSet := range []bool{decoded.And != nil, decoded.Or != nil, decoded.Column != nil, decoded.Exists != nil, decoded.Aggregate != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.Errorf("Where clause part must have exactly one of and, or, column, exists, aggregate: %s", data)
+	}
+	if decoded.Column != nil {
+		return decoded.Column, nil
+	}
+	if decoded.Aggregate != nil {
+		return decoded.Aggregate, nil
+	}
+	if decoded.Exists != nil {
+		condition, err := unmarshalWhereClause(decoded.Exists.Where)
+		if err != nil {
+			return nil, err
+		}
+		return &WcExists{Joins: decoded.Exists.Joins, Condition: condition}, nil
+	}
+	encodedOperands := decoded.And
+	if decoded.Or != nil {
+		encodedOperands = decoded.Or
+	}
+	operands := make([]WhereClausePart, 0, len(encodedOperands))
+	for _, encodedOperand := range encodedOperands {
+		operand, err := unmarshalWhereClause(encodedOperand)
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+	}
+	if decoded.Or != nil {
+		return &WcOr{Operands: operands}, nil
+	}
+	return &WcAnd{Operands: operands}, nil
+}
+
+type queryFields Query
+
+type queryJSON struct {
+	*queryFields
+	WhereClause json.RawMessage `json:"whereClause,omitempty"`
+	Having      json.RawMessage `json:"having,omitempty"`
+}
+
+func (q *Query) MarshalJSON() ([]byte, error) {
+	whereClause, err := marshalWhereClause(q.WhereClause)
+	if err != nil {
+		return nil, err
+	}
+	having, err := marshalWhereClause(q.Having)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(queryJSON{queryFields: (*queryFields)(q), WhereClause: whereClause, Having: having})
+}
+
+func (q *Query) UnmarshalJSON(data []byte) error {
+	decoded := queryJSON{queryFields: (*queryFields)(q)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	whereClause, err := unmarshalWhereClause(decoded.WhereClause)
+	if err != nil {
+		return err
+	}
+	q.WhereClause = whereClause
+	having, err := unmarshalWhereClause(decoded.Having)
+	if err != nil {
+		return err
+	}
+	q.Having = having
+	return nil
+}
+
+type qualifiedColumnFields QualifiedColumn
+
+// UnmarshalJSON decodes integral numeric values as integers, so that they are
+// bound as such rather than as floating point values.
+func (qc *QualifiedColumn) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode((*qualifiedColumnFields)(qc)); err != nil {
+		return err
+	}
+	number, isNumber := qc.Value.(json.Number)
+	if !isNumber {
+		return nil
+	}
+	if value, err := number.Int64(); err == nil {
+		qc.Value = value
+		return nil
+	}
+	value, err := number.Float64()
+	if err != nil || math.IsInf(value, 0) {
+		return errors.Errorf("Invalid numeric value %s", number)
+	}
+	qc.Value = value
+	return nil
+}
@@ -0,0 +1,55 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryJSONRoundTrip(t *testing.T) {
+	q := &Query{
+		Name:             "alerts",
+		Statement:        "select",
+		StatementTargets: []Target{Raw("count(*)")},
+		TargetTables:     []string{"alerts"},
+		WhereClause: &WcAnd{
+			Operands: []WhereClausePart{
+				&QualifiedColumn{TableName: "alerts", ColumnName: "Policy_Severity", Value: int64(3)},
+				&WcOr{
+					Operands: []WhereClausePart{
+						&QualifiedColumn{TableName: "alerts", ColumnName: "Policy_Name", Value: "Latest tag"},
+						&QualifiedColumn{TableName: "alerts", ColumnName: "Score", Value: 1.5},
+					},
+				},
+				&WcExists{
+					Joins: []InnerJoin{
+						{
+							Left:  QualifiedColumn{TableName: "alerts", ColumnName: "Deployment_Id"},
+							Right: QualifiedColumn{TableName: "deployments", ColumnName: "Id"},
+						},
+					},
+					Condition: &QualifiedColumn{TableName: "deployments", ColumnName: "ClusterId", Value: "cluster-1"},
+				},
+			},
+		},
+	}
+	q.GroupBy = []QualifiedColumn{{TableName: "alerts", ColumnName: "Deployment_Id"}}
+	q.Having = &WcAggregate{Function: "count", Operator: ">", Column: QualifiedColumn{Value: int64(2)}}
+	data, err := json.Marshal(q)
+	require.NoError(t, err)
+	decoded := &Query{}
+	require.NoError(t, json.Unmarshal(data, decoded))
+	assert.Equal(t, q, decoded)
+}
+
+func TestWhereClauseJSONErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"whereClause": {}}`,
+		`{"whereClause": {"and": [], "or": []}}`,
+		`{"whereClause": {"and": [{"column": {"table": "a", "column": "b"}, "or": []}]}}`,
+	} {
+		assert.Error(t, json.Unmarshal([]byte(data), &Query{}), data)
+	}
+}
@@ -0,0 +1,66 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func QuoteLiteral(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return quoteString(v), nil
+	case bool:
+		if v {
+			return "true", nil
+		}
+		return "false", nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v), nil
+	case float32:
+		return quoteFloat(float64(v)), nil
+	case float64:
+		return quoteFloat(v), nil
+	case time.Time:
+		return quoteString(v.Format(time.RFC3339Nano)), nil
+	case []string:
+		return quoteArray(v), nil
+	default:
+		return "", errors.Errorf("unsupported literal type %T", value)
+	}
+}
+
+func quoteString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// quoteArray renders the values as a quoted array literal, whose element
+// type is resolved from its context, e.g. the text[] of an unnest cast.
+func quoteArray(values []string) string {
+	elements := make([]string, 0, len(values))
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	for _, value := range values {
+		elements = append(elements, `"`+escaper.Replace(value)+`"`)
+	}
+	return quoteString("{" + strings.Join(elements, ",") + "}")
+}
+
+// quoteFloat renders the special values, which are not numeric constants,
+// as the strings Postgres reads them from.
+func quoteFloat(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "'NaN'"
+	case math.IsInf(value, 1):
+		return "'Infinity'"
+	case math.IsInf(value, -1):
+		return "'-Infinity'"
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
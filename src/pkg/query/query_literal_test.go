@@ -0,0 +1,37 @@
+package query
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteLiteral(t *testing.T) {
+	for name, tc := range map[string]struct {
+		value    interface{}
+		expected string
+	}{
+		"null":          {value: nil, expected: "null"},
+		"string":        {value: "it's", expected: "'it''s'"},
+		"bool":          {value: true, expected: "true"},
+		"int":           {value: int64(-3), expected: "-3"},
+		"float":         {value: 2.5, expected: "2.5"},
+		"float32":       {value: float32(0.25), expected: "0.25"},
+		"NaN":           {value: math.NaN(), expected: "'NaN'"},
+		"infinity":      {value: math.Inf(1), expected: "'Infinity'"},
+		"minus inf":     {value: float32(math.Inf(-1)), expected: "'-Infinity'"},
+		"time":          {value: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), expected: "'2024-01-02T03:04:05Z'"},
+		"quoted string": {value: "NaN", expected: "'NaN'"},
+		"array":         {value: []string{"c1", `we"ird\'`}, expected: `'{"c1","we\"ird\\''"}'`},
+	} {
+		literal, err := QuoteLiteral(tc.value)
+		require.NoError(t, err, name)
+		assert.Equal(t, tc.expected, literal, name)
+	}
+
+	_, err := QuoteLiteral([]int{1})
+	assert.Error(t, err)
+}
@@ -0,0 +1,166 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	GeneratorList         = "list"
+	GeneratorColumn       = "column"
+	GeneratorRange        = "range"
+	GeneratorRelativeTime = "relativeTime"
+)
+
+// Generator describes how the values of a template parameter are produced.
+// The fields used depend on the kind:
+// - list: the fixed Values,
+// - column: Count values sampled from the distinct values of Table.Column,
+// - range: Count integers drawn in [Min, Max],
+// - relativeTime: timestamps at the Offsets (e.g. "-24h") from the run start.
+type Generator struct {
+	Kind    string        `json:"kind"`
+	Values  []interface{} `json:"values,omitempty"`
+	Table   string        `json:"table,omitempty"`
+	Column  string        `json:"column,omitempty"`
+	Count   int           `json:"count,omitempty"`
+	Min     int64         `json:"min,omitempty"`
+	Max     int64         `json:"max,omitempty"`
+	Offsets []string      `json:"offsets,omitempty"`
+}
+
+type Parameter struct {
+	Name      string    `json:"name"`
+	Generator Generator `json:"generator"`
+}
+
+type BoundParameter struct {
+	Name  string
+	Value interface{}
+}
+
+// IsTemplate tells whether the query has parameters to bind before execution.
+func (q *Query) IsTemplate() bool {
+	return len(q.Parameters) > 0
+}
+
+func placeholders(part WhereClausePart, names []string) []string {
+	switch p := part.(type) {
+	case *QualifiedColumn:
+		if p.Placeholder != "" {
+			names = append(names, p.Placeholder)
+		}
+	case *WcAggregate:
+		if p.Column.Placeholder != "" {
+			names = append(names, p.Column.Placeholder)
+		}
+	case *WcAnd:
+		for _, operand := range p.Operands {
+			names = append(names, placeholders(operand, nil)...)
+		}
+	case *WcOr:
+		for _, operand := range p.Operands {
+			names = append(names, placeholders(operand, nil)...)
+		}
+	case *WcExists:
+		names = placeholders(p.Condition, names)
+	}
+	return names
+}
+
+// Placeholders lists the placeholder names used in the query where and
+// having clauses.
+func (q *Query) Placeholders() []string {
+	return placeholders(q.Having, placeholders(q.WhereClause, make([]string, 0)))
+}
+
+func bindWhereClause(part WhereClausePart, values map[string]interface{}) (WhereClausePart, error) {
+	switch p := part.(type) {
+	case nil:
+		return nil, nil
+	case *QualifiedColumn:
+		if p.Placeholder == "" {
+			return p, nil
+		}
+		value, found := values[p.Placeholder]
+		if !found {
+			return nil, errors.Errorf("No value for placeholder %q", p.Placeholder)
+		}
+		return &QualifiedColumn{TableName: p.TableName, ColumnName: p.ColumnName, Value: value, Type: p.Type}, nil
+	case *WcAggregate:
+		column, err := bindWhereClause(&p.Column, values)
+		if err != nil {
+			return nil, err
+		}
+		return &WcAggregate{Function: p.Function, Operator: p.Operator, Column: *column.(*QualifiedColumn)}, nil
+	case *WcAnd:
+		operands, err := bindOperands(p.Operands, values)
+		if err != nil {
+			return nil, err
+		}
+		return &WcAnd{Operands: operands}, nil
+	case *WcOr:
+		operands, err := bindOperands(p.Operands, values)
+		if err != nil {
+			return nil, err
+		}
+		return &WcOr{Operands: operands}, nil
+	case *WcExists:
+		condition, err := bindWhereClause(p.Condition, values)
+		if err != nil {
+			return nil, err
+		}
+		return &WcExists{Joins: p.Joins, Condition: condition}, nil
+	default:
+		return nil, errors.Errorf("Unsupported where clause part %T", part)
+	}
+}
+
+func bindOperands(operands []WhereClausePart, values map[string]interface{}) ([]WhereClausePart, error) {
+	result := make([]WhereClausePart, 0, len(operands))
+	for _, operand := range operands {
+		bound, err := bindWhereClause(operand, values)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, bound)
+	}
+	return result, nil
+}
+
+func formatParameterValue(value interface{}) string {
+	if t, isTime := value.(time.Time); isTime {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
+
+// Bind returns the concrete query obtained by replacing the template
+// placeholders with the given parameter values. The concrete query is named
+// after the template and the values.
+func (q *Query) Bind(parameters []BoundParameter) (*Query, error) {
+	values := make(map[string]interface{}, len(parameters))
+	nameParts := make([]string, 0, len(parameters))
+	for _, parameter := range parameters {
+		values[parameter.Name] = parameter.Value
+		nameParts = append(nameParts, fmt.Sprintf("%s=%s", parameter.Name, formatParameterValue(parameter.Value)))
+	}
+	whereClause, err := bindWhereClause(q.WhereClause, values)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not bind the parameters of query %q", q.Name)
+	}
+	having, err := bindWhereClause(q.Having, values)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not bind the parameters of query %q", q.Name)
+	}
+	result := *q
+	result.Name = fmt.Sprintf("%s[%s]", q.Name, strings.Join(nameParts, ","))
+	result.Template = q.Name
+	result.Parameters = nil
+	result.WhereClause = whereClause
+	result.Having = having
+	return &result, nil
+}
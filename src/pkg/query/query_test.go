@@ -0,0 +1,151 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForExecutionClauseOrder(t *testing.T) {
+	q := &Query{
+		Name:             "alerts-by-deployment",
+		Statement:        "select",
+		StatementTargets: []Target{{Column: &QualifiedColumn{TableName: "alerts", ColumnName: "Deployment_Id"}}, Raw("count(*)")},
+		TargetTables:     []string{"alerts"},
+		WhereClause:      &QualifiedColumn{TableName: "alerts", ColumnName: "State", Value: 0},
+		GroupBy:          []QualifiedColumn{{TableName: "alerts", ColumnName: "Deployment_Id"}},
+		Having:           &WcAggregate{Function: "count", Operator: ">", Column: QualifiedColumn{Value: 2}},
+		OrderBy:          []OrderColumn{{Column: QualifiedColumn{TableName: "alerts", ColumnName: "Deployment_Id"}, Reversed: true}},
+		QueryPagination:  &Pagination{Limit: 10, Offset: 20},
+	}
+	stmt, bindValues := q.ForExecution()
+	assert.Equal(
+		t,
+		"select alerts.Deployment_Id, count(*) from alerts where alerts.State = $1"+
+			" group by alerts.Deployment_Id having count(*) > $2"+
+			" order by alerts.Deployment_Id desc limit 10 offset 20",
+		stmt,
+	)
+	assert.Equal(t, []interface{}{0, 2}, bindValues)
+}
+
+func TestRenderMarkerInName(t *testing.T) {
+	q := &Query{
+		Statement:        "select",
+		StatementTargets: []Target{{Expression: "count(*)", Alias: "n$$"}},
+		TargetTables:     []string{"alerts"},
+		WhereClause:      &QualifiedColumn{TableName: "alerts", ColumnName: "State", Value: 0},
+	}
+	assert.Error(t, q.Validate())
+	assert.NotPanics(t, func() { q.ForExecution() })
+}
+
+func TestBindHaving(t *testing.T) {
+	template := &Query{
+		Name:             "busy-deployments",
+		Statement:        "select",
+		StatementTargets: []Target{{Column: &QualifiedColumn{TableName: "alerts", ColumnName: "Deployment_Id"}}},
+		TargetTables:     []string{"alerts"},
+		WhereClause:      &QualifiedColumn{TableName: "alerts", ColumnName: "Policy_Severity", Placeholder: "severity"},
+		GroupBy:          []QualifiedColumn{{TableName: "alerts", ColumnName: "Deployment_Id"}},
+		Having: &WcAggregate{
+			Function: "max",
+			Operator: ">=",
+			Column:   QualifiedColumn{TableName: "alerts", ColumnName: "Time", Placeholder: "since"},
+		},
+		Parameters: []Parameter{{Name: "severity"}, {Name: "since"}},
+	}
+	assert.Equal(t, []string{"severity", "since"}, template.Placeholders())
+
+	bound, err := template.Bind([]BoundParameter{{Name: "severity", Value: 3}, {Name: "since", Value: "2024-01-01"}})
+	require.NoError(t, err)
+	stmt, bindValues := bound.ForExecution()
+	assert.Equal(
+		t,
+		"select alerts.Deployment_Id from alerts where alerts.Policy_Severity = $1 group by alerts.Deployment_Id having max(alerts.Time) >= $2",
+		stmt,
+	)
+	assert.Equal(t, []interface{}{3, "2024-01-01"}, bindValues)
+
+	_, err = template.Bind([]BoundParameter{{Name: "severity", Value: 3}})
+	assert.Error(t, err)
+}
+
+func TestRenderCasts(t *testing.T) {
+	q := &Query{
+		Statement:        "select",
+		StatementTargets: []Target{Raw("count(*)")},
+		TargetTables:     []string{"alerts"},
+		WhereClause: &WcAnd{
+			Operands: []WhereClausePart{
+				&QualifiedColumn{TableName: "alerts", ColumnName: "ClusterId", Value: "c1", Type: "uuid"},
+				&QualifiedColumn{TableName: "alerts", ColumnName: "Namespace", Value: "default"},
+			},
+		},
+		GroupBy: []QualifiedColumn{{TableName: "alerts", ColumnName: "Policy_Severity"}},
+		Having:  &WcAggregate{Function: "count", Operator: ">", Column: QualifiedColumn{Value: 2, Type: "bigint"}},
+	}
+	assert.True(t, q.Typed())
+	stmt, bindValues := q.ForExecution()
+	assert.Equal(
+		t,
+		"select count(*) from alerts where ( alerts.ClusterId = $1::uuid and alerts.Namespace = $2 )"+
+			" group by alerts.Policy_Severity having count(*) > $3::bigint",
+		stmt,
+	)
+	assert.Equal(t, []interface{}{"c1", "default", 2}, bindValues)
+
+	uncast := q.WithRendering(RenderOptions{OmitCasts: true})
+	stmt, bindValues = uncast.ForExecution()
+	assert.Equal(
+		t,
+		"select count(*) from alerts where ( alerts.ClusterId = $1 and alerts.Namespace = $2 )"+
+			" group by alerts.Policy_Severity having count(*) > $3",
+		stmt,
+	)
+	assert.Equal(t, []interface{}{"c1", "default", 2}, bindValues)
+	assert.Equal(t, RenderOptions{}, q.Rendering, "the query must not be modified")
+
+	assert.False(t, (&Query{WhereClause: &QualifiedColumn{TableName: "alerts", ColumnName: "State"}}).Typed())
+	assert.True(t, (&Query{ScopeLevel: "cluster", ScopeClusterType: "uuid"}).Typed())
+
+	assert.False(t, (&Query{}).Paginated())
+	assert.False(t, (&Query{QueryPagination: &Pagination{}}).Paginated())
+	assert.True(t, (&Query{QueryPagination: &Pagination{Limit: 10}}).Paginated())
+	assert.True(t, (&Query{QueryPagination: &Pagination{Offset: 10}}).Paginated())
+}
+
+func TestRenderLiterals(t *testing.T) {
+	q := &Query{
+		Statement:        "select",
+		StatementTargets: []Target{Raw("count(*)")},
+		TargetTables:     []string{"alerts"},
+		WhereClause: &WcAnd{
+			Operands: []WhereClausePart{
+				&QualifiedColumn{TableName: "alerts", ColumnName: "ClusterId", Value: "c1", Type: "uuid"},
+				&QualifiedColumn{TableName: "alerts", ColumnName: "Namespace", Value: "o'brien"},
+				&QualifiedColumn{TableName: "alerts", ColumnName: "Tags", Value: []string{"a"}},
+				&QualifiedColumn{TableName: "alerts", ColumnName: "Severities", Value: []int{1}},
+				&QualifiedColumn{TableName: "alerts", ColumnName: "State", Value: 3},
+			},
+		},
+	}
+	stmt, bindValues := q.WithRendering(RenderOptions{InlineLiterals: true}).ForExecution()
+	assert.Equal(
+		t,
+		"select count(*) from alerts where ( alerts.ClusterId = 'c1'::uuid and alerts.Namespace = 'o''brien'"+
+			" and alerts.Tags = '{\"a\"}' and alerts.Severities = $1 and alerts.State = 3 )",
+		stmt,
+	)
+	assert.Equal(t, []interface{}{[]int{1}}, bindValues, "values without a literal form stay bound")
+
+	stmt, bindValues = q.WithRendering(RenderOptions{InlineLiterals: true, OmitCasts: true}).ForExecution()
+	assert.Equal(
+		t,
+		"select count(*) from alerts where ( alerts.ClusterId = 'c1' and alerts.Namespace = 'o''brien'"+
+			" and alerts.Tags = '{\"a\"}' and alerts.Severities = $1 and alerts.State = 3 )",
+		stmt,
+	)
+	assert.Len(t, bindValues, 1)
+}
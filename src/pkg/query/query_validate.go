@@ -0,0 +1,176 @@
+package query
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	functionName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+	// typeName matches the names of the types values are cast to, e.g.
+	// uuid, character varying(255), timestamp(6) with time zone or text[].
+	typeName  = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\([0-9]+(, ?[0-9]+)?\))?( [a-z_][a-z0-9_]*)*(\([0-9]+(, ?[0-9]+)?\))?(\[\])*$`)
+	operators = []string{"=", "<>", "!=", "<", "<=", ">", ">="}
+)
+
+// Validate checks the structured fields of the query, so that it renders
+// as a single well-formed statement.
+func (q *Query) Validate() error {
+	if !strings.EqualFold(q.Statement, "select") {
+		return errors.Errorf("Unsupported statement %q", q.Statement)
+	}
+	if len(q.TargetTables) == 0 {
+		return errors.New("No target table")
+	}
+	for ix, target := range q.StatementTargets {
+		if err := target.Validate(); err != nil {
+			return errors.Wrapf(err, "Invalid statement target %d", ix)
+		}
+	}
+	for _, table := range q.TargetTables {
+		if err := ValidateIdentifier(table); err != nil {
+			return errors.Wrap(err, "Invalid target table")
+		}
+	}
+	if err := validateJoins(q.InnerJoins); err != nil {
+		return errors.Wrap(err, "Invalid inner join")
+	}
+	if err := validateWhereClause(q.WhereClause); err != nil {
+		return errors.Wrap(err, "Invalid where clause")
+	}
+	for _, column := range q.GroupBy {
+		if err := validateColumn(&column); err != nil {
+			return errors.Wrap(err, "Invalid group by")
+		}
+	}
+	if err := validateWhereClause(q.Having); err != nil {
+		return errors.Wrap(err, "Invalid having clause")
+	}
+	for _, order := range q.OrderBy {
+		if err := validateColumn(&order.Column); err != nil {
+			return errors.Wrap(err, "Invalid order by")
+		}
+	}
+	if q.QueryPagination != nil && (q.QueryPagination.Limit < 0 || q.QueryPagination.Offset < 0) {
+		return errors.New("Negative pagination")
+	}
+	return q.validateScope()
+}
+
+func (q *Query) validateScope() error {
+	if q.ScopeLevel != "cluster" && q.ScopeLevel != "namespace" {
+		return nil
+	}
+	columns := []string{q.ScopeTable, q.ScopeClusterColumn}
+	if q.ScopeLevel == "namespace" {
+		columns = append(columns, q.ScopeNamespaceColumn)
+	}
+	for _, name := range columns {
+		if err := ValidateIdentifier(name); err != nil {
+			return errors.Wrap(err, "Invalid scope")
+		}
+	}
+	if err := validateJoins(q.ScopeJoins); err != nil {
+		return errors.Wrap(err, "Invalid scope join")
+	}
+	for _, name := range []string{q.ScopeClusterType, q.ScopeNamespaceType} {
+		if err := validateType(name); err != nil {
+			return errors.Wrap(err, "Invalid scope")
+		}
+	}
+	return nil
+}
+
+func validateType(name string) error {
+	if name == "" {
+		return nil
+	}
+	return ValidateType(name)
+}
+
+// ValidateType checks that the name is a plain type name, as rendered by
+// format_type, which can be used in a statement as is.
+func ValidateType(name string) error {
+	if !typeName.MatchString(name) {
+		return errors.Errorf("Invalid type %q", name)
+	}
+	return nil
+}
+
+func validateColumn(column *QualifiedColumn) error {
+	if err := validateType(column.Type); err != nil {
+		return err
+	}
+	if column.TableName != "" {
+		if err := ValidateIdentifier(column.TableName); err != nil {
+			return err
+		}
+	}
+	return ValidateIdentifier(column.ColumnName)
+}
+
+func validateJoins(joins []InnerJoin) error {
+	for _, join := range joins {
+		for _, column := range []*QualifiedColumn{&join.Left, &join.Right} {
+			if err := ValidateIdentifier(column.TableName); err != nil {
+				return err
+			}
+			if err := ValidateIdentifier(column.ColumnName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateWhereClause(part WhereClausePart) error {
+	switch p := part.(type) {
+	case nil:
+		return nil
+	case *QualifiedColumn:
+		return validateColumn(p)
+	case *WcAggregate:
+		if !functionName.MatchString(p.Function) {
+			return errors.Errorf("Invalid aggregate function %q", p.Function)
+		}
+		if p.Operator != "" && !slices.Contains(operators, p.Operator) {
+			return errors.Errorf("Invalid operator %q", p.Operator)
+		}
+		if p.Column.ColumnName == "" {
+			return validateType(p.Column.Type)
+		}
+		return validateColumn(&p.Column)
+	case *WcAnd:
+		return validateOperands(p.Operands)
+	case *WcOr:
+		return validateOperands(p.Operands)
+	case *WcExists:
+		if len(p.Joins) == 0 {
+			return errors.New("Exists without join")
+		}
+		if err := validateJoins(p.Joins); err != nil {
+			return err
+		}
+		return validateWhereClause(p.Condition)
+	default:
+		return errors.Errorf("Unsupported where clause part %T", part)
+	}
+}
+
+func validateOperands(operands []WhereClausePart) error {
+	if len(operands) == 0 {
+		return errors.New("No operand")
+	}
+	for _, operand := range operands {
+		if operand == nil {
+			return errors.New("Nil operand")
+		}
+		if err := validateWhereClause(operand); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func validQuery() *Query {
+	return &Query{
+		Name:             "alerts",
+		Statement:        "select",
+		StatementTargets: []Target{Raw("count(*)")},
+		TargetTables:     []string{"alerts"},
+		WhereClause: &WcOr{
+			Operands: []WhereClausePart{
+				&QualifiedColumn{TableName: "alerts", ColumnName: "State", Value: 0},
+				&QualifiedColumn{TableName: "alerts", ColumnName: "State", Value: 3},
+			},
+		},
+		GroupBy:              []QualifiedColumn{{TableName: "alerts", ColumnName: "Policy_Severity"}},
+		Having:               &WcAggregate{Function: "count", Operator: ">", Column: QualifiedColumn{Value: 1}},
+		ScopeLevel:           "namespace",
+		ScopeTable:           "alerts",
+		ScopeClusterColumn:   "ClusterId",
+		ScopeNamespaceColumn: "Namespace",
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, validQuery().Validate())
+
+	for name, modify := range map[string]func(q *Query){
+		"statement":       func(q *Query) { q.Statement = "delete" },
+		"no target table": func(q *Query) { q.TargetTables = nil },
+		"empty table":     func(q *Query) { q.TargetTables = []string{""} },
+		"target":          func(q *Query) { q.StatementTargets = []Target{Raw("1; select 2")} },
+		"empty target":    func(q *Query) { q.StatementTargets = []Target{{}} },
+		"join":            func(q *Query) { q.InnerJoins = []InnerJoin{{Left: QualifiedColumn{TableName: "alerts"}}} },
+		"where column":    func(q *Query) { q.WhereClause = &QualifiedColumn{TableName: "alerts"} },
+		"empty or":        func(q *Query) { q.WhereClause = &WcOr{} },
+		"exists":          func(q *Query) { q.WhereClause = &WcExists{Condition: q.WhereClause} },
+		"aggregate":       func(q *Query) { q.Having = &WcAggregate{Function: "count(*) > 0 or max"} },
+		"operator":        func(q *Query) { q.Having = &WcAggregate{Function: "count", Operator: "= 1 or 1 ="} },
+		"order by":        func(q *Query) { q.OrderBy = []OrderColumn{{Column: QualifiedColumn{TableName: "alerts"}}} },
+		"pagination":      func(q *Query) { q.QueryPagination = &Pagination{Limit: -1} },
+		"scope column":    func(q *Query) { q.ScopeNamespaceColumn = "" },
+		"scope join":      func(q *Query) { q.ScopeJoins = []InnerJoin{{}} },
+		"type":            func(q *Query) { q.ScopeClusterType = "uuid; drop table alerts" },
+		"alias null":      func(q *Query) { q.StatementTargets = []Target{{Expression: "count(*)", Alias: "a\x00"}} },
+		"column and target": func(q *Query) {
+			q.StatementTargets = []Target{{Expression: "1", Column: &QualifiedColumn{ColumnName: "a"}}}
+		},
+	} {
+		q := validQuery()
+		modify(q)
+		assert.Error(t, q.Validate(), name)
+	}
+
+	unscoped := validQuery()
+	unscoped.ScopeLevel = "global"
+	unscoped.ScopeTable = ""
+	assert.NoError(t, unscoped.Validate())
+}
+
+func TestValidateType(t *testing.T) {
+	for _, name := range []string{
+		"uuid",
+		"text[]",
+		"character varying(255)",
+		"numeric(10,2)",
+		"timestamp without time zone",
+		"timestamp(6) with time zone",
+	} {
+		assert.NoError(t, ValidateType(name), name)
+	}
+	for _, name := range []string{"", "uuid; drop table alerts", "int default 1", "text check (true)", "UUID"} {
+		assert.Error(t, ValidateType(name), name)
+	}
+}
@@ -2,6 +2,7 @@ package query
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 )
 
@@ -9,8 +10,42 @@ type WhereClausePart interface {
 	AsWhereClausePart() (string, []interface{})
 }
 
+// TypedValue is a bind value rendered with a cast to its type.
+type TypedValue struct {
+	Value interface{}
+	Type  string
+}
+
+func (qc *QualifiedColumn) bindValue() interface{} {
+	if qc.Type == "" {
+		return qc.Value
+	}
+	return TypedValue{Value: qc.Value, Type: qc.Type}
+}
+
 func (qc *QualifiedColumn) AsWhereClausePart() (string, []interface{}) {
-	return fmt.Sprintf("%s.%s = $$", qc.TableName, qc.ColumnName), []interface{}{qc.Value}
+	return fmt.Sprintf("%s = $$", qc.Identifier()), []interface{}{qc.bindValue()}
+}
+
+// WcAggregate compares an aggregate of a column with the value of the column,
+// in a having clause. The column is rendered as * when it has no name, e.g.
+// count(*) > $1.
+type WcAggregate struct {
+	Function string          `json:"function"`
+	Operator string          `json:"operator,omitempty"`
+	Column   QualifiedColumn `json:"column"`
+}
+
+func (wcp *WcAggregate) AsWhereClausePart() (string, []interface{}) {
+	argument := "*"
+	if wcp.Column.ColumnName != "" {
+		argument = wcp.Column.Identifier()
+	}
+	operator := wcp.Operator
+	if operator == "" {
+		operator = "="
+	}
+	return fmt.Sprintf("%s(%s) %s $$", wcp.Function, argument, operator), []interface{}{wcp.Column.bindValue()}
 }
 
 type WcOr struct {
@@ -52,3 +87,73 @@ func (wcp *WcAnd) AsWhereClausePart() (string, []interface{}) {
 	qb.WriteString(" )")
 	return qb.String(), values
 }
+
+// WcExists restricts the rows of the statement to the ones related, through
+// the joins, to rows matching the condition. The first join correlates the
+// subquery with a table of the statement.
+type WcExists struct {
+	Joins     []InnerJoin
+	Condition WhereClausePart
+}
+
+func (wcp *WcExists) AsWhereClausePart() (string, []interface{}) {
+	if wcp.Condition == nil {
+		return ExistsSubquery(wcp.Joins, "true"), []interface{}{}
+	}
+	condition, values := wcp.Condition.AsWhereClausePart()
+	return ExistsSubquery(wcp.Joins, condition), values
+}
+
+// ExistsSubquery renders an exists subquery following the join path from a
+// table of the outer statement, with the given condition.
+func ExistsSubquery(joins []InnerJoin, condition string) string {
+	if len(joins) == 0 {
+		return condition
+	}
+	first := joins[0]
+	var qb strings.Builder
+	qb.WriteString("exists ( select 1 from ")
+	qb.WriteString(QuoteIdentifier(first.Right.TableName))
+	for _, join := range joins[1:] {
+		qb.WriteString(renderJoin(join))
+	}
+	qb.WriteString(fmt.Sprintf(" where %s = %s and %s )", first.Left.Identifier(), first.Right.Identifier(), condition))
+	return qb.String()
+}
+
+// MaxBindParameters is the number of bind parameters a statement is
+// limited to by the Postgres protocol.
+const MaxBindParameters = 65535
+
+// WcIn restricts the columns to the rows of a subquery, e.g. one unnesting
+// arrays bound as values, rendered as $$ markers in the subquery.
+type WcIn struct {
+	Columns  []QualifiedColumn
+	Subquery string
+	Values   []interface{}
+}
+
+func (wcp *WcIn) AsWhereClausePart() (string, []interface{}) {
+	columns := make([]string, 0, len(wcp.Columns))
+	for _, column := range wcp.Columns {
+		columns = append(columns, column.Identifier())
+	}
+	return fmt.Sprintf("( %s ) in ( %s )", strings.Join(columns, ", "), wcp.Subquery), slices.Clone(wcp.Values)
+}
+
+func typed(part WhereClausePart) bool {
+	switch p := part.(type) {
+	case *QualifiedColumn:
+		return p.Type != ""
+	case *WcAggregate:
+		return p.Column.Type != ""
+	case *WcAnd:
+		return slices.ContainsFunc(p.Operands, typed)
+	case *WcOr:
+		return slices.ContainsFunc(p.Operands, typed)
+	case *WcExists:
+		return typed(p.Condition)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,261 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/explain"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/prepared"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/scope"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/statements"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/tablestats"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/verify"
+)
+
+const (
+	SelectionNone    = "none"
+	SelectionOrdered = "ordered"
+	SelectionRandom  = "random"
+
+	InjectionNone   = "none"
+	InjectionOrTree = "or-tree"
+	InjectionExists = "exists"
+	InjectionRLS    = "rls"
+
+	RenderingDefault  = ""
+	RenderingNoCasts  = "no-casts"
+	RenderingLiterals = "literals"
+
+	FallbackArray = "array"
+	FallbackTable = "temp-table"
+
+	// StatusTimeout marks the entries whose statement exceeded the statement
+	// timeout or the budget of the query, StatusSkipped the ones left out
+	// once the budget of the query was exhausted, and StatusCancelled the
+	// ones of an interrupted run.
+	StatusTimeout   = "timeout"
+	StatusSkipped   = "skipped"
+	StatusCancelled = "cancelled"
+)
+
+// Execution holds the measurements of one of the repeated executions of
+// a query. The first execution may run against a cold buffer cache.
+type Execution struct {
+	Iteration        int     `json:"iteration"`
+	PlanningTime     float64 `json:"planningTime"`
+	ExecutionTime    float64 `json:"executionTime"`
+	SharedHitBlocks  int64   `json:"sharedHitBlocks"`
+	SharedReadBlocks int64   `json:"sharedReadBlocks"`
+}
+
+type Entry struct {
+	Query       string             `json:"query"`
+	Template    string             `json:"template,omitempty"`
+	Statement   string             `json:"statement"`
+	Selection   string             `json:"selection"`
+	Injection   string             `json:"injection"`
+	Rendering   string             `json:"rendering,omitempty"`
+	ScopeSize   int                `json:"scopeSize"`
+	ScopeStats  *scope.Stats       `json:"scopeStats,omitempty"`
+	CacheMode   string             `json:"cacheMode"`
+	Plan        *explain.Plan      `json:"plan,omitempty"`
+	Executions  []Execution        `json:"executions,omitempty"`
+	GenericPlan *prepared.Analysis `json:"genericPlan,omitempty"`
+	Statements  *statements.Delta  `json:"statements,omitempty"`
+	// Verification describes the result set of the statement, when the
+	// result sets of the injection strategies were compared.
+	Verification *verify.Result `json:"verification,omitempty"`
+	// Fallback is the injection the scope filter fell back to, when the
+	// statement exceeded the bind parameter limit.
+	Fallback string `json:"fallback,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Report struct {
+	lock sync.Mutex
+
+	Database  string              `json:"database"`
+	StartedAt time.Time           `json:"startedAt"`
+	Queries   []*query.Query      `json:"queries"`
+	Tables    []*tablestats.Table `json:"tables"`
+	Entries   []*Entry            `json:"entries"`
+	// Planned is the number of entries the run is expected to produce.
+	Planned    int        `json:"planned"`
+	Done       bool       `json:"done"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+type Progress struct {
+	Planned   int  `json:"planned"`
+	Completed int  `json:"completed"`
+	Done      bool `json:"done"`
+}
+
+func New(database string) *Report {
+	return &Report{
+		Database:  database,
+		StartedAt: time.Now(),
+		Entries:   make([]*Entry, 0),
+	}
+}
+
+// Query returns the definition of the query with the given name, nil if
+// the report does not have it.
+func (r *Report) Query(name string) *query.Query {
+	for _, q := range r.Queries {
+		if q.Name == name {
+			return q
+		}
+	}
+	return nil
+}
+
+func (r *Report) Add(entry *Entry) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Entries = append(r.Entries, entry)
+}
+
+func (r *Report) SetPlanned(planned int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Planned = planned
+}
+
+// SetTables records the table statistics, which may be captured while the
+// report is served.
+func (r *Report) SetTables(tables []*tablestats.Table) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Tables = tables
+}
+
+func (r *Report) Finish() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	finishedAt := time.Now()
+	r.Done = true
+	r.FinishedAt = &finishedAt
+}
+
+func (r *Report) Progress() Progress {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return Progress{Planned: r.Planned, Completed: len(r.Entries), Done: r.Done}
+}
+
+// Snapshot returns a copy of the report that is not affected by the entries
+// added afterwards. Entries are shared and must not be modified once added.
+func (r *Report) Snapshot() *Report {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return &Report{
+		Database:   r.Database,
+		StartedAt:  r.StartedAt,
+		Queries:    r.Queries,
+		Tables:     r.Tables,
+		Entries:    slices.Clone(r.Entries),
+		Planned:    r.Planned,
+		Done:       r.Done,
+		FinishedAt: r.FinishedAt,
+	}
+}
+
+func (r *Report) WriteFile(path string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Could not encode report")
+	}
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Could not write report to %q", path)
+	}
+	return nil
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r.Snapshot()); err != nil {
+		return errors.Wrap(err, "Could not encode report")
+	}
+	return nil
+}
+
+func ReadFile(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not read report from %q", path)
+	}
+	r := &Report{}
+	if err = json.Unmarshal(data, r); err != nil {
+		return nil, errors.Wrapf(err, "Could not decode report from %q", path)
+	}
+	return r, nil
+}
+
+// Mismatches returns the entries whose result set differs from the one of
+// the reference injection strategy.
+func (r *Report) Mismatches() []*Entry {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	mismatches := make([]*Entry, 0)
+	for _, entry := range r.Entries {
+		if entry.Verification != nil && entry.Verification.Reference != "" && !entry.Verification.Match {
+			mismatches = append(mismatches, entry)
+		}
+	}
+	return mismatches
+}
+
+// Interrupted returns the entries that timed out, were skipped or were
+// cancelled.
+func (r *Report) Interrupted() []*Entry {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	interrupted := make([]*Entry, 0)
+	for _, entry := range r.Entries {
+		if entry.Status != "" {
+			interrupted = append(interrupted, entry)
+		}
+	}
+	return interrupted
+}
+
+// First returns the first execution of the entry, nil if there was none.
+func (e *Entry) First() *Execution {
+	if len(e.Executions) == 0 {
+		return nil
+	}
+	return &e.Executions[0]
+}
+
+// Warm returns the mean measurements of the executions following the
+// first one, nil if there were none.
+func (e *Entry) Warm() *Execution {
+	if len(e.Executions) < 2 {
+		return nil
+	}
+	warm := &Execution{}
+	for _, execution := range e.Executions[1:] {
+		warm.PlanningTime += execution.PlanningTime
+		warm.ExecutionTime += execution.ExecutionTime
+		warm.SharedHitBlocks += execution.SharedHitBlocks
+		warm.SharedReadBlocks += execution.SharedReadBlocks
+	}
+	count := len(e.Executions) - 1
+	warm.PlanningTime /= float64(count)
+	warm.ExecutionTime /= float64(count)
+	warm.SharedHitBlocks /= int64(count)
+	warm.SharedReadBlocks /= int64(count)
+	return warm
+}
@@ -0,0 +1,88 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+var csvHeader = []string{
+	"query",
+	"selection",
+	"injection",
+	"rendering",
+	"fallback",
+	"scope_size",
+	"cache_mode",
+	"first_planning_time_ms",
+	"first_execution_time_ms",
+	"first_shared_hit_blocks",
+	"first_shared_read_blocks",
+	"warm_planning_time_ms",
+	"warm_execution_time_ms",
+	"warm_shared_hit_blocks",
+	"warm_shared_read_blocks",
+	"statements_calls",
+	"statements_total_exec_time_ms",
+	"statements_rows",
+	"status",
+	"error",
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 3, 64)
+}
+
+func executionColumns(execution *Execution) []string {
+	if execution == nil {
+		return []string{"", "", "", ""}
+	}
+	return []string{
+		formatFloat(execution.PlanningTime),
+		formatFloat(execution.ExecutionTime),
+		fmt.Sprint(execution.SharedHitBlocks),
+		fmt.Sprint(execution.SharedReadBlocks),
+	}
+}
+
+// WriteCSV writes one line per entry with the first and steady state
+// execution measurements.
+func (r *Report) WriteCSV(w io.Writer) error {
+	snapshot := r.Snapshot()
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return errors.Wrap(err, "Could not write CSV header")
+	}
+	for _, entry := range snapshot.Entries {
+		record := []string{
+			entry.Query,
+			entry.Selection,
+			entry.Injection,
+			entry.Rendering,
+			entry.Fallback,
+			fmt.Sprint(entry.ScopeSize),
+			entry.CacheMode,
+		}
+		record = append(record, executionColumns(entry.First())...)
+		record = append(record, executionColumns(entry.Warm())...)
+		if entry.Statements != nil {
+			record = append(
+				record,
+				fmt.Sprint(entry.Statements.Calls),
+				formatFloat(entry.Statements.TotalExecTime),
+				fmt.Sprint(entry.Statements.Rows),
+			)
+		} else {
+			record = append(record, "", "", "")
+		}
+		record = append(record, entry.Status, entry.Error)
+		if err := writer.Write(record); err != nil {
+			return errors.Wrap(err, "Could not write CSV record")
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
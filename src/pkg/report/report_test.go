@@ -0,0 +1,105 @@
+package report
+
+import (
+	"encoding/csv"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/verify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirstAndWarm(t *testing.T) {
+	entry := &Entry{}
+	assert.Nil(t, entry.First())
+	assert.Nil(t, entry.Warm())
+
+	entry.Executions = []Execution{
+		{Iteration: 1, PlanningTime: 4, ExecutionTime: 100, SharedHitBlocks: 10, SharedReadBlocks: 90},
+	}
+	assert.Equal(t, &entry.Executions[0], entry.First())
+	assert.Nil(t, entry.Warm())
+
+	entry.Executions = append(entry.Executions,
+		Execution{Iteration: 2, PlanningTime: 1, ExecutionTime: 12, SharedHitBlocks: 100, SharedReadBlocks: 0},
+		Execution{Iteration: 3, PlanningTime: 3, ExecutionTime: 8, SharedHitBlocks: 98, SharedReadBlocks: 2},
+	)
+	assert.Equal(t, &Execution{PlanningTime: 2, ExecutionTime: 10, SharedHitBlocks: 99, SharedReadBlocks: 1}, entry.Warm())
+}
+
+func TestWriteAndReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+	r := New("central_active")
+	r.Add(&Entry{
+		Query:      "query-0",
+		Statement:  "select count(*) from alerts",
+		Selection:  SelectionOrdered,
+		Injection:  InjectionOrTree,
+		ScopeSize:  10,
+		Executions: []Execution{{Iteration: 1, PlanningTime: 1, ExecutionTime: 2}},
+	})
+	r.Finish()
+	require.NoError(t, r.WriteFile(path))
+
+	read, err := ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, r.Database, read.Database)
+	assert.True(t, r.StartedAt.Equal(read.StartedAt))
+	assert.Equal(t, r.Entries, read.Entries)
+	assert.True(t, read.Done)
+	require.NotNil(t, read.FinishedAt)
+	assert.True(t, r.FinishedAt.Equal(*read.FinishedAt))
+}
+
+func TestMismatches(t *testing.T) {
+	r := New("central_active")
+	reference := &Entry{Injection: InjectionOrTree, Verification: &verify.Result{Rows: 3, Checksum: "a"}}
+	same := &Entry{Injection: InjectionRLS, Verification: &verify.Result{Rows: 3, Checksum: "a", Reference: InjectionOrTree, Match: true}}
+	different := &Entry{Injection: InjectionExists, Verification: &verify.Result{Rows: 2, Checksum: "b", Reference: InjectionOrTree}}
+	for _, entry := range []*Entry{reference, same, different, {Injection: InjectionNone}} {
+		r.Add(entry)
+	}
+	assert.Equal(t, []*Entry{different}, r.Mismatches())
+}
+
+func TestInterrupted(t *testing.T) {
+	r := New("central_active")
+	timeout := &Entry{Injection: InjectionOrTree, Status: StatusTimeout, Error: "statement timeout exceeded"}
+	skipped := &Entry{Injection: InjectionExists, Status: StatusSkipped}
+	for _, entry := range []*Entry{{Injection: InjectionNone}, timeout, {Injection: InjectionRLS, Error: "failed"}, skipped} {
+		r.Add(entry)
+	}
+	assert.Equal(t, []*Entry{timeout, skipped}, r.Interrupted())
+}
+
+func TestWriteCSV(t *testing.T) {
+	r := New("central_active")
+	r.Add(&Entry{
+		Query:      "query-0",
+		Selection:  SelectionOrdered,
+		Injection:  InjectionOrTree,
+		Rendering:  RenderingLiterals,
+		Fallback:   FallbackArray,
+		ScopeSize:  10,
+		CacheMode:  "warm",
+		Executions: []Execution{{Iteration: 1, PlanningTime: 1, ExecutionTime: 2, SharedHitBlocks: 3, SharedReadBlocks: 4}},
+		Status:     StatusTimeout,
+		Error:      "statement timeout exceeded",
+	})
+	builder := &strings.Builder{}
+	require.NoError(t, r.WriteCSV(builder))
+
+	records, err := csv.NewReader(strings.NewReader(builder.String())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, csvHeader, records[0])
+	assert.Equal(t, []string{
+		"query-0", "ordered", "or-tree", "literals", "array", "10", "warm",
+		"1.000", "2.000", "3", "4",
+		"", "", "", "",
+		"", "", "",
+		"timeout", "statement timeout exceeded",
+	}, records[1])
+}
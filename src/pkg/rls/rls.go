@@ -0,0 +1,174 @@
+package rls
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/scope"
+)
+
+const (
+	Role       = "sacsqlperf_rls"
+	ScopeTable = "sacsqlperf_scope"
+	policyName = "sacsqlperf_scope_policy"
+	// lockTimeout bounds the wait for the lock of the scope table, rather
+	// than queueing the other sessions behind the session.
+	lockTimeout = "5s"
+
+	columnTypesStatement = `select
+max(format_type(atttypid, atttypmod)) filter (where attname = 'clusterid'),
+max(format_type(atttypid, atttypmod)) filter (where attname = 'namespace')
+from pg_attribute where attrelid = $1::regclass`
+)
+
+// Session is a transaction in which the scope table of a request is
+// protected by a row-level security policy restricting it to the rows of
+// a scope. The statements of the session run as a role the policy applies
+// to, the superusers and table owners bypassing row-level security.
+//
+// Enabling row-level security locks the scope table until the session is
+// closed, its transaction is rolled back.
+type Session struct {
+	tx pgx.Tx
+}
+
+// Begin opens a session restricting the scope table of the request to the
+// given scope.
+func Begin(ctx context.Context, database db.DB, request *query.Query, namespaces []scope.ScopeNamespace) (*Session, error) {
+	if request.ScopeLevel != "cluster" && request.ScopeLevel != "namespace" {
+		return nil, errors.Errorf("query %q has no cluster or namespace scope", request.Name)
+	}
+	tx, err := database.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not begin transaction")
+	}
+	session := &Session{tx: tx}
+	if err = session.setUp(ctx, request, namespaces); err != nil {
+		_ = tx.Rollback(ctx)
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *Session) setUp(ctx context.Context, request *query.Query, namespaces []scope.ScopeNamespace) error {
+	err := CreateScopeTable(ctx, s.tx, ScopeTable, request, namespaces)
+	if err != nil {
+		return err
+	}
+	statements := []string{
+		fmt.Sprintf("create role %s nologin", Role),
+		fmt.Sprintf("grant select on %s to %s", ScopeTable, Role),
+	}
+	for _, table := range request.Tables() {
+		statements = append(statements, fmt.Sprintf("grant select on %s to %s", query.QuoteIdentifier(table), Role))
+	}
+	policyTable, condition := policyTarget(request)
+	policyTable = query.QuoteIdentifier(policyTable)
+	statements = append(
+		statements,
+		fmt.Sprintf("set local lock_timeout = '%s'", lockTimeout),
+		fmt.Sprintf("alter table %s enable row level security", policyTable),
+		fmt.Sprintf("create policy %s on %s for select to %s using (%s)", policyName, policyTable, Role, condition),
+		fmt.Sprintf("set local role %s", Role),
+	)
+	for _, stmt := range statements {
+		if _, err = s.tx.Exec(ctx, stmt); err != nil {
+			return errors.Wrapf(err, "Could not set up row-level security: %s", stmt)
+		}
+	}
+	return nil
+}
+
+// DB runs statements in the session.
+func (s *Session) DB() db.DB {
+	return s.tx
+}
+
+// Close rolls the session back, removing the policy, role and scope table.
+func (s *Session) Close(ctx context.Context) error {
+	err := s.tx.Rollback(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Could not roll back row-level security session")
+	}
+	return nil
+}
+
+// policyTarget returns the table the policy protects and its condition.
+// Requests reaching their scope table through their scope path get the
+// policy on the first table of the path, with the condition checked in an
+// exists subquery following the path.
+func policyTarget(request *query.Query) (string, string) {
+	if request.ReachesScopeTable() || len(request.ScopeJoins) == 0 {
+		return request.ScopeTable, policyCondition(request, "")
+	}
+	condition := policyCondition(request, query.QuoteIdentifier(request.ScopeTable)+".")
+	return request.ScopeJoins[0].Left.TableName, query.ExistsSubquery(request.ScopeJoins, condition)
+}
+
+func policyCondition(request *query.Query, qualifier string) string {
+	if request.ScopeLevel == "cluster" {
+		return fmt.Sprintf("%s%s in (select clusterid from %s)", qualifier, query.QuoteIdentifier(request.ScopeClusterColumn), ScopeTable)
+	}
+	return fmt.Sprintf(
+		"(%s%s, %s%s) in (select clusterid, namespace from %s)",
+		qualifier,
+		query.QuoteIdentifier(request.ScopeClusterColumn),
+		qualifier,
+		query.QuoteIdentifier(request.ScopeNamespaceColumn),
+		ScopeTable,
+	)
+}
+
+// CreateScopeTable creates a table of the (clusterid, namespace) pairs of
+// the scope, with the types of the scope columns of the request, and
+// analyzes it for the planner. The table is meant to be created in a
+// transaction that is rolled back.
+func CreateScopeTable(ctx context.Context, database db.DB, name string, request *query.Query, namespaces []scope.ScopeNamespace) error {
+	namespaceColumn := "null::text"
+	if request.ScopeNamespaceColumn != "" {
+		namespaceColumn = query.QuoteIdentifier(request.ScopeNamespaceColumn)
+	}
+	_, err := database.Exec(ctx, fmt.Sprintf(
+		"create table %s as select %s as clusterid, %s as namespace from %s limit 0",
+		name,
+		query.QuoteIdentifier(request.ScopeClusterColumn),
+		namespaceColumn,
+		query.QuoteIdentifier(request.ScopeTable),
+	))
+	if err != nil {
+		return errors.Wrapf(err, "Could not create scope table %s", name)
+	}
+	clusterIDs := make([]string, 0, len(namespaces))
+	namespaceNames := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		clusterIDs = append(clusterIDs, ns.ClusterID)
+		namespaceNames = append(namespaceNames, ns.NamespaceName)
+	}
+	var clusterType, namespaceType string
+	err = database.QueryRow(ctx, columnTypesStatement, name).Scan(&clusterType, &namespaceType)
+	if err != nil {
+		return errors.Wrapf(err, "Could not read column types of scope table %s", name)
+	}
+	_, err = database.Exec(
+		ctx,
+		fmt.Sprintf(
+			"insert into %s (clusterid, namespace) select c::%s, n::%s from unnest($1::text[], $2::text[]) as u(c, n)",
+			name,
+			clusterType,
+			namespaceType,
+		),
+		clusterIDs,
+		namespaceNames,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "Could not fill scope table %s", name)
+	}
+	if _, err = database.Exec(ctx, fmt.Sprintf("analyze %s", name)); err != nil {
+		return errors.Wrapf(err, "Could not analyze scope table %s", name)
+	}
+	return nil
+}
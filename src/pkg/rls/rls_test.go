@@ -0,0 +1,112 @@
+package rls
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db/dbtest"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/scope"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var namespaces = []scope.ScopeNamespace{
+	{ClusterID: "cluster-1", NamespaceName: "default"},
+	{ClusterID: "cluster-2", NamespaceName: "payments"},
+}
+
+func scopedQuery(level string) *query.Query {
+	return &query.Query{
+		Name:             "deployments",
+		Statement:        "select",
+		StatementTargets: []query.Target{query.Raw("count(*)")},
+		TargetTables:     []string{"images"},
+		InnerJoins: []query.InnerJoin{
+			{
+				Left:  query.QualifiedColumn{TableName: "images", ColumnName: "Id"},
+				Right: query.QualifiedColumn{TableName: "deployments", ColumnName: "Image_Id"},
+			},
+		},
+		ScopeLevel:           level,
+		ScopeTable:           "deployments",
+		ScopeClusterColumn:   "ClusterId",
+		ScopeNamespaceColumn: "Namespace",
+	}
+}
+
+func TestBegin(t *testing.T) {
+	fake := dbtest.New().On(columnTypesStatement, dbtest.Result{Rows: [][]any{{"uuid", "character varying"}}})
+	session, err := Begin(context.Background(), fake, scopedQuery("namespace"), namespaces)
+	require.NoError(t, err)
+	require.NoError(t, session.Close(context.Background()))
+
+	calls := fake.Calls()
+	statements := fake.Statements()
+	assert.Equal(t, []string{
+		dbtest.StatementBegin,
+		"create table sacsqlperf_scope as select ClusterId as clusterid, Namespace as namespace from deployments limit 0",
+		columnTypesStatement,
+		"insert into sacsqlperf_scope (clusterid, namespace) select c::uuid, n::character varying from unnest($1::text[], $2::text[]) as u(c, n)",
+		"analyze sacsqlperf_scope",
+		"create role sacsqlperf_rls nologin",
+		"grant select on sacsqlperf_scope to sacsqlperf_rls",
+		"grant select on images to sacsqlperf_rls",
+		"grant select on deployments to sacsqlperf_rls",
+		"set local lock_timeout = '5s'",
+		"alter table deployments enable row level security",
+		"create policy sacsqlperf_scope_policy on deployments for select to sacsqlperf_rls" +
+			" using ((ClusterId, Namespace) in (select clusterid, namespace from sacsqlperf_scope))",
+		"set local role sacsqlperf_rls",
+		dbtest.StatementRollback,
+	}, statements)
+	assert.Equal(t, []any{[]string{"cluster-1", "cluster-2"}, []string{"default", "payments"}}, calls[3].Args)
+}
+
+func TestBeginClusterScope(t *testing.T) {
+	fake := dbtest.New().On(columnTypesStatement, dbtest.Result{Rows: [][]any{{"uuid", "character varying"}}})
+	session, err := Begin(context.Background(), fake, scopedQuery("cluster"), namespaces)
+	require.NoError(t, err)
+	require.NoError(t, session.Close(context.Background()))
+	assert.Contains(
+		t,
+		fake.Statements(),
+		"create policy sacsqlperf_scope_policy on deployments for select to sacsqlperf_rls"+
+			" using (ClusterId in (select clusterid from sacsqlperf_scope))",
+	)
+}
+
+func TestBeginScopePath(t *testing.T) {
+	request := scopedQuery("namespace")
+	request.ScopeJoins = request.InnerJoins
+	request.InnerJoins = nil
+	fake := dbtest.New().On(columnTypesStatement, dbtest.Result{Rows: [][]any{{"uuid", "character varying"}}})
+	session, err := Begin(context.Background(), fake, request, namespaces)
+	require.NoError(t, err)
+	require.NoError(t, session.Close(context.Background()))
+	statements := fake.Statements()
+	assert.Contains(t, statements, "grant select on deployments to sacsqlperf_rls")
+	assert.Contains(t, statements, "alter table images enable row level security")
+	assert.Contains(
+		t,
+		statements,
+		"create policy sacsqlperf_scope_policy on images for select to sacsqlperf_rls"+
+			" using (exists ( select 1 from deployments where images.Id = deployments.Image_Id"+
+			" and (deployments.ClusterId, deployments.Namespace) in (select clusterid, namespace from sacsqlperf_scope) ))",
+	)
+}
+
+func TestBeginError(t *testing.T) {
+	_, err := Begin(context.Background(), dbtest.New(), scopedQuery(""), namespaces)
+	assert.Error(t, err)
+
+	failure := errors.New("permission denied to create role")
+	fake := dbtest.New().
+		On(columnTypesStatement, dbtest.Result{Rows: [][]any{{"uuid", "character varying"}}}).
+		On("create role", dbtest.Result{Err: failure})
+	_, err = Begin(context.Background(), fake, scopedQuery("namespace"), namespaces)
+	assert.ErrorIs(t, err, failure)
+	statements := fake.Statements()
+	assert.Equal(t, dbtest.StatementRollback, statements[len(statements)-1])
+}
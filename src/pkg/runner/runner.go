@@ -0,0 +1,824 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/cache"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/explain"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/prepared"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/report"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/rls"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/sac"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/scope"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/statements"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/tablestats"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/verify"
+)
+
+const (
+	namespaceCountStatement = "select count(*) from namespaces"
+	namespacesStatement     = "select clusterid, name from namespaces"
+)
+
+type Options struct {
+	// Executions is the number of executions of each query, the first one
+	// is reported as cold.
+	Executions int
+	// CacheMode is the buffer cache preparation before the first execution
+	// of each query.
+	CacheMode string
+	// GenericPlans enables the analysis of the custom and generic plans of
+	// the prepared SAC-injected statements.
+	GenericPlans bool
+	// PreparedExecutions is the number of executions of each prepared
+	// statement for the generic plan analysis.
+	PreparedExecutions int
+	// RLS enables the profiling of the unmodified queries with the scope
+	// enforced by a row-level security policy, next to the injected filter.
+	RLS bool
+	// Verify enables the comparison of the result sets of the injection
+	// strategies with the one of the VerifyReference strategy.
+	Verify          bool
+	VerifyReference string
+	// CompareCasts enables the profiling of the SAC-injected statements with
+	// typed bind values rendered without their casts as well.
+	CompareCasts bool
+	// CompareLiterals enables the profiling of the SAC-injected statements
+	// with their bind values inlined as literals as well.
+	CompareLiterals bool
+	// StatementTimeout cancels the statements running longer, zero leaving
+	// them to the statement_timeout of the server.
+	StatementTimeout time.Duration
+	// QueryBudget is the time allotted to the profiling of each query,
+	// zero for no limit. The entries of the query left once it is exhausted
+	// are recorded as skipped.
+	QueryBudget time.Duration
+}
+
+// Causes of the cancellation of the statements, ErrRunBudget being the one
+// of the context of a run that exceeded its budget.
+var (
+	ErrStatementTimeout = errors.New("statement timeout exceeded")
+	ErrQueryBudget      = errors.New("query budget exhausted")
+	ErrRunBudget        = errors.New("run budget exhausted")
+)
+
+// Selection is a list of scopes of increasing size, picked with one of the
+// namespace selection strategies.
+type Selection struct {
+	Name   string
+	Scopes [][]scope.ScopeNamespace
+}
+
+// Runner profiles the queries on a database.
+type Runner struct {
+	db      db.DB
+	options Options
+	evictor *cache.Evictor
+	// scopeStats caches the statistics of the scopes, by scope table and
+	// scope.
+	scopeStats map[string]*scope.Stats
+}
+
+func New(database db.DB, options Options) *Runner {
+	return &Runner{db: database, options: options, scopeStats: make(map[string]*scope.Stats)}
+}
+
+// PlannedEntries is the number of entries a run of the queries records.
+func (r *Runner) PlannedEntries(queries []*query.Query, selections []Selection) int {
+	planned := 0
+	for _, q := range queries {
+		planned++
+		for _, selection := range selections {
+			for _, scope := range selection.Scopes {
+				for _, injected := range inject(q, scope) {
+					planned += len(r.renderings(q, bindFallback(q, injected)))
+				}
+				if r.options.RLS {
+					planned++
+				}
+			}
+		}
+	}
+	return planned
+}
+
+// usesScopePath tells whether the query reaches its scope table through
+// its scope path, the SAC filter being then also profiled in an exists
+// subquery.
+func usesScopePath(q *query.Query) bool {
+	return len(q.ScopeJoins) > 0 && !q.ReachesScopeTable()
+}
+
+// DatabaseName returns the name of the database the runner is connected to.
+func (r *Runner) DatabaseName(ctx context.Context) (string, error) {
+	var dbName string
+	err := r.db.QueryRow(ctx, "select current_database()").Scan(&dbName)
+	if err != nil {
+		return "", errors.Wrap(err, "Could not read database name")
+	}
+	return dbName, nil
+}
+
+// DiscoverNamespaces lists the namespace names by cluster ID.
+func (r *Runner) DiscoverNamespaces(ctx context.Context) (map[string][]string, error) {
+	fmt.Println("Running", namespaceCountStatement)
+	var namespaceCount int
+	err := r.db.QueryRow(ctx, namespaceCountStatement).Scan(&namespaceCount)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not count namespaces")
+	}
+	fmt.Printf("Found %d namespaces\n", namespaceCount)
+	rows, err := r.db.Query(ctx, namespacesStatement)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not query namespaces")
+	}
+	defer rows.Close()
+	c := 0
+	namespacesByCluster := make(map[string][]string, 0)
+	for rows.Next() {
+		var clusterID string
+		var namespaceName string
+		err = rows.Scan(&clusterID, &namespaceName)
+		if err != nil {
+			continue
+		}
+		c++
+		namespacesByCluster[clusterID] = append(namespacesByCluster[clusterID], namespaceName)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Could not read namespaces")
+	}
+	fmt.Printf("Selected %d namespaces\n", c)
+	for clusterID, namespaces := range namespacesByCluster {
+		fmt.Printf("Found %d namespaces for cluster %q\n", len(namespaces), clusterID)
+	}
+	return namespacesByCluster, nil
+}
+
+// Validate has the server parse every statement of a run of the queries
+// without executing them, the SAC-injected ones being restricted to the
+// first scope of the selections, in each of their renderings. The array
+// filters the queries with scope types fall back to, and the row-level
+// security set-up, are checked on the same scope. It fails on the first
+// statement that does not parse.
+func (r *Runner) Validate(ctx context.Context, queries []*query.Query, selections []Selection) error {
+	var sample []scope.ScopeNamespace
+	for _, selection := range selections {
+		for _, scope := range selection.Scopes {
+			if len(sample) == 0 {
+				sample = scope
+			}
+		}
+	}
+	for _, q := range queries {
+		if err := r.check(ctx, r.db, q, report.InjectionNone, q); err != nil {
+			return err
+		}
+		if len(sample) == 0 {
+			continue
+		}
+		for _, injected := range inject(q, sample) {
+			if err := r.checkRenderings(ctx, r.db, q, injected.injection, "", injected.request); err != nil {
+				return err
+			}
+			if q.ScopeClusterType != "" && (q.ScopeLevel == "cluster" || q.ScopeNamespaceType != "") {
+				arrays := injected.apply(q, sac.ArrayFilter(q, sample))
+				if err := r.checkRenderings(ctx, r.db, q, injected.injection, report.FallbackArray, arrays); err != nil {
+					return err
+				}
+			} else if q.ScopeLevel == "cluster" || q.ScopeLevel == "namespace" {
+				if err := r.checkScopeTable(ctx, q, injected, sample); err != nil {
+					return err
+				}
+			}
+		}
+		if r.options.RLS && (q.ScopeLevel == "cluster" || q.ScopeLevel == "namespace") {
+			if err := r.checkRLS(ctx, q, sample); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Runner) checkRenderings(ctx context.Context, database db.DB, q *query.Query, injection, fallback string, request *query.Query) error {
+	for _, rendering := range r.renderings(q, fallback) {
+		if err := r.check(ctx, database, q, injection, request.WithRendering(renderOptions(rendering))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkScopeTable creates the temporary scope table of the query in a
+// transaction rolled back afterwards, and has the injected request filtered
+// by it parsed there.
+func (r *Runner) checkScopeTable(ctx context.Context, q *query.Query, injected injectedRequest, namespaces []scope.ScopeNamespace) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Could not begin transaction")
+	}
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+	if err = rls.CreateScopeTable(ctx, tx, fallbackScopeTable, q, namespaces); err != nil {
+		return errors.Wrapf(err, "Invalid scope table set-up for query %q", q.Name)
+	}
+	request := injected.apply(q, sac.TableFilter(q, namespaces, fallbackScopeTable))
+	return r.checkRenderings(ctx, tx, q, injected.injection, report.FallbackTable, request)
+}
+
+func (r *Runner) check(ctx context.Context, database db.DB, q *query.Query, injection string, request *query.Query) error {
+	stmt, _ := request.ForExecution()
+	if err := prepared.Check(ctx, database, stmt); err != nil {
+		return errors.Wrapf(err, "Invalid statement for query %q with %s injection: %s", q.Name, injection, stmt)
+	}
+	return nil
+}
+
+// checkRLS sets up the row-level security session of the query, and has
+// the unmodified query parsed in it.
+func (r *Runner) checkRLS(ctx context.Context, q *query.Query, namespaces []scope.ScopeNamespace) error {
+	session, err := rls.Begin(ctx, r.db, q, namespaces)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid row-level security set-up for query %q", q.Name)
+	}
+	defer func() { _ = session.Close(context.WithoutCancel(ctx)) }()
+	return r.check(ctx, session.DB(), q, report.InjectionRLS, q)
+}
+
+// Run profiles every query without scope, then restricted to each scope of
+// the selections, and passes the entries to record as they complete.
+func (r *Runner) Run(ctx context.Context, queries []*query.Query, selections []Selection, record func(*report.Entry)) error {
+	if r.options.CacheMode == cache.ModeEvict {
+		fmt.Println("Creating cache eviction table")
+		evictor, err := cache.NewEvictor(ctx, r.db)
+		if err != nil {
+			return errors.Wrap(err, "Could not create cache evictor")
+		}
+		r.evictor = evictor
+		defer func() {
+			if err := evictor.Close(context.WithoutCancel(ctx)); err != nil {
+				fmt.Printf("Error removing cache eviction table: %v\n", err)
+			}
+			r.evictor = nil
+		}()
+	}
+	for _, q := range queries {
+		if err := r.runQuery(ctx, q, selections, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runQuery profiles the query within its budget. It stops when the run is
+// interrupted, the entries profiled until then being recorded.
+func (r *Runner) runQuery(ctx context.Context, q *query.Query, selections []Selection, record func(*report.Entry)) error {
+	queryCtx := ctx
+	if r.options.QueryBudget > 0 {
+		var cancel context.CancelFunc
+		queryCtx, cancel = context.WithTimeoutCause(ctx, r.options.QueryBudget, ErrQueryBudget)
+		defer cancel()
+	}
+	fmt.Printf("Query %q: %s\n", q.Name, q.Description)
+	stmt, _ := q.ForExecution()
+	fmt.Println(stmt)
+	record(r.ProfileQuery(queryCtx, &report.Entry{
+		Query:     q.Name,
+		Template:  q.Template,
+		Selection: report.SelectionNone,
+		Injection: report.InjectionNone,
+	}, q))
+	for _, selection := range selections {
+		for _, scope := range selection.Scopes {
+			if ctx.Err() != nil {
+				return errors.Wrap(context.Cause(ctx), "Run interrupted")
+			}
+			for _, entry := range r.profileScope(queryCtx, q, selection.Name, scope) {
+				record(entry)
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return errors.Wrap(context.Cause(ctx), "Run interrupted")
+	}
+	return nil
+}
+
+// interrupted marks the entry as not profiled when the context of its query
+// is done: skipped when the budget of the query is exhausted, cancelled
+// when the run is interrupted.
+func interrupted(ctx context.Context, entry *report.Entry) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	entry.Status = report.StatusCancelled
+	if context.Cause(ctx) == ErrQueryBudget {
+		entry.Status = report.StatusSkipped
+	}
+	entry.Error = context.Cause(ctx).Error()
+	fmt.Printf("Not profiling %d %s namespaces with %s injection: %s\n", entry.ScopeSize, entry.Selection, entry.Injection, entry.Error)
+	return true
+}
+
+// statementContext bounds a statement by the statement timeout.
+func (r *Runner) statementContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return r.statementsContext(ctx, 1)
+}
+
+// statementsContext bounds a sequence of statements by the statement timeout
+// of each of them.
+func (r *Runner) statementsContext(ctx context.Context, count int) (context.Context, context.CancelFunc) {
+	if r.options.StatementTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, time.Duration(count)*r.options.StatementTimeout, ErrStatementTimeout)
+}
+
+// failure records the error of the statement run in the context, as a
+// timeout or a cancellation when the context is done.
+func failure(ctx context.Context, entry *report.Entry, err error) {
+	entry.Error = err.Error()
+	if ctx.Err() == nil {
+		return
+	}
+	cause := context.Cause(ctx)
+	entry.Error = cause.Error()
+	entry.Status = report.StatusCancelled
+	if cause == ErrStatementTimeout || cause == ErrQueryBudget {
+		entry.Status = report.StatusTimeout
+	}
+}
+
+// fallbackScopeTable is the table holding the scopes of the statements
+// falling back to a temporary table.
+const fallbackScopeTable = "sacsqlperf_fallback_scope"
+
+// injectedRequest is a query restricted to a scope by an injection strategy,
+// which applies other filters of the scope table the same way.
+type injectedRequest struct {
+	injection string
+	request   *query.Query
+	apply     func(*query.Query, query.WhereClausePart) *query.Query
+}
+
+// inject restricts the query to the scope with the filter injection
+// strategies applying to it.
+func inject(q *query.Query, scope []scope.ScopeNamespace) []injectedRequest {
+	requests := []injectedRequest{
+		{injection: report.InjectionOrTree, request: sac.InjectFilter(q, scope), apply: sac.JoinFilter},
+	}
+	if usesScopePath(q) {
+		requests = append(requests, injectedRequest{
+			injection: report.InjectionExists,
+			request:   sac.InjectExists(q, scope),
+			apply:     sac.ExistsFilter,
+		})
+	}
+	return requests
+}
+
+// bindFallback returns the filter the injected request falls back to when its
+// statement exceeds the bind parameter limit, empty otherwise: arrays for
+// the queries with scope types, a temporary scope table for the others.
+func bindFallback(q *query.Query, injected injectedRequest) string {
+	_, bindValues := injected.request.ForExecution()
+	if len(bindValues) <= query.MaxBindParameters {
+		return ""
+	}
+	if q.ScopeClusterType != "" && (q.ScopeLevel == "cluster" || q.ScopeNamespaceType != "") {
+		return report.FallbackArray
+	}
+	return report.FallbackTable
+}
+
+// renderings lists the rendering variants of the SAC-injected statements of
+// the query. The fallback filters cast their values themselves, from text
+// arrays or to the types of a scope table: the statements falling back to
+// them are not rendered without casts.
+func (r *Runner) renderings(q *query.Query, fallback string) []string {
+	renderings := []string{report.RenderingDefault}
+	if r.options.CompareCasts && q.Typed() && fallback == "" {
+		renderings = append(renderings, report.RenderingNoCasts)
+	}
+	if r.options.CompareLiterals {
+		renderings = append(renderings, report.RenderingLiterals)
+	}
+	return renderings
+}
+
+func renderOptions(rendering string) query.RenderOptions {
+	return query.RenderOptions{
+		OmitCasts:      rendering == report.RenderingNoCasts,
+		InlineLiterals: rendering == report.RenderingLiterals,
+	}
+}
+
+// profileScope profiles the query restricted to the scope with each
+// injection strategy, and compares their result sets when verifying.
+func (r *Runner) profileScope(ctx context.Context, q *query.Query, selection string, scope []scope.ScopeNamespace) []*report.Entry {
+	stats := r.statsOf(ctx, q, selection, scope)
+	newEntry := func(injection string) *report.Entry {
+		return &report.Entry{
+			Query:      q.Name,
+			Template:   q.Template,
+			Selection:  selection,
+			Injection:  injection,
+			ScopeSize:  len(scope),
+			ScopeStats: stats,
+		}
+	}
+	entries := make([]*report.Entry, 0)
+	for _, injected := range inject(q, scope) {
+		fallback := bindFallback(q, injected)
+		switch fallback {
+		case report.FallbackArray:
+			injected.request = injected.apply(q, sac.ArrayFilter(q, scope))
+		case report.FallbackTable:
+			injected.request = injected.apply(q, sac.TableFilter(q, scope, fallbackScopeTable))
+		}
+		if fallback != "" {
+			fmt.Printf(
+				"Statement for %d %s namespaces with %s injection exceeds %d bind parameters, falling back to %s\n",
+				len(scope),
+				selection,
+				injected.injection,
+				query.MaxBindParameters,
+				fallback,
+			)
+		}
+		for _, rendering := range r.renderings(q, fallback) {
+			entry := newEntry(injected.injection)
+			entry.Fallback = fallback
+			request := injected.request
+			if rendering == report.RenderingDefault {
+				fmt.Printf("Getting plan for %d %s namespaces with %s injection\n", len(scope), selection, injected.injection)
+			} else {
+				fmt.Printf("Getting plan for %d %s namespaces with %s injection, %s\n", len(scope), selection, injected.injection, rendering)
+				entry.Rendering = rendering
+				request = request.WithRendering(renderOptions(rendering))
+			}
+			if fallback == report.FallbackTable {
+				entries = append(entries, r.ProfileScopeTable(ctx, entry, request, q, scope))
+			} else {
+				entries = append(entries, r.ProfileQuery(ctx, entry, request))
+			}
+		}
+	}
+	if r.options.RLS {
+		fmt.Printf("Getting plan for %d %s namespaces with row-level security\n", len(scope), selection)
+		entries = append(entries, r.ProfileRLS(ctx, newEntry(report.InjectionRLS), q, scope))
+	}
+	if r.options.Verify {
+		// The order by clause of the query is not known to be total, the
+		// strategies may return different pages of the same rows.
+		if q.Paginated() {
+			fmt.Printf("Result sets of query %q are not compared, its pages depend on the plan\n", q.Name)
+		} else {
+			compareResults(entries, r.options.VerifyReference)
+		}
+	}
+	return entries
+}
+
+// statsOf returns the statistics of the scope, with the rows it covers in
+// the scope table of the query. They are computed once for the queries
+// sharing the scope table.
+func (r *Runner) statsOf(ctx context.Context, q *query.Query, selection string, namespaces []scope.ScopeNamespace) *scope.Stats {
+	namespaceColumn := ""
+	if q.ScopeLevel == "namespace" {
+		namespaceColumn = q.ScopeNamespaceColumn
+	}
+	key := fmt.Sprintf("%s/%s/%s/%s/%d", q.ScopeTable, q.ScopeClusterColumn, namespaceColumn, selection, len(namespaces))
+	if stats, found := r.scopeStats[key]; found {
+		return stats
+	}
+	stats := scope.ComputeStats(namespaces)
+	if q.ScopeTable != "" && q.ScopeClusterColumn != "" && ctx.Err() == nil {
+		err := stats.CountRows(ctx, r.db, q.ScopeTable, q.ScopeClusterColumn, namespaceColumn, namespaces)
+		if err != nil {
+			fmt.Printf("Error computing scope statistics: %v\n", err)
+		}
+	}
+	fmt.Printf(
+		"Scope of %d %s namespaces: %d clusters, %d to %d namespaces per cluster, %d of %d %s rows (%.1f%%)\n",
+		stats.Namespaces,
+		selection,
+		stats.Clusters,
+		stats.NamespacesPerCluster.Min,
+		stats.NamespacesPerCluster.Max,
+		stats.RowsCovered,
+		stats.TotalRows,
+		q.ScopeTable,
+		100*stats.RowFraction,
+	)
+	if ctx.Err() == nil {
+		r.scopeStats[key] = stats
+	}
+	return stats
+}
+
+// compareResults compares the result sets of the entries with the one of
+// the entry of the reference strategy.
+func compareResults(entries []*report.Entry, reference string) {
+	var referenceEntry *report.Entry
+	for _, entry := range entries {
+		if entry.Injection == reference && entry.Rendering == report.RenderingDefault && entry.Verification != nil {
+			referenceEntry = entry
+		}
+	}
+	if referenceEntry == nil {
+		fmt.Printf("No %s result set to compare with\n", reference)
+		return
+	}
+	for _, entry := range entries {
+		if entry == referenceEntry || entry.Verification == nil {
+			continue
+		}
+		if entry.Verification.Compare(reference, referenceEntry.Verification) {
+			continue
+		}
+		fmt.Printf(
+			"Mismatch for query %q with %d %s namespaces: %s returned %d rows (checksum %s), %s returned %d rows (checksum %s)\n",
+			entry.Query,
+			entry.ScopeSize,
+			entry.Selection,
+			entry.Injection,
+			entry.Verification.Rows,
+			entry.Verification.Checksum,
+			reference,
+			referenceEntry.Verification.Rows,
+			referenceEntry.Verification.Checksum,
+		)
+	}
+}
+
+// CaptureTableStats records the data shape of the tables referenced by
+// the queries, with the planner statistics of their scope columns.
+func (r *Runner) CaptureTableStats(ctx context.Context, queries []*query.Query) []*tablestats.Table {
+	tables := make([]string, 0)
+	scopeColumnsByTable := make(map[string][]string)
+	for _, q := range queries {
+		for _, table := range q.Tables() {
+			if _, found := scopeColumnsByTable[table]; !found {
+				tables = append(tables, table)
+				scopeColumnsByTable[table] = make([]string, 0)
+			}
+		}
+		if q.ScopeTable == "" {
+			continue
+		}
+		for _, column := range []string{q.ScopeClusterColumn, q.ScopeNamespaceColumn} {
+			if column != "" && !slices.Contains(scopeColumnsByTable[q.ScopeTable], column) {
+				scopeColumnsByTable[q.ScopeTable] = append(scopeColumnsByTable[q.ScopeTable], column)
+			}
+		}
+	}
+	result := make([]*tablestats.Table, 0, len(tables))
+	for _, table := range tables {
+		fmt.Printf("Capturing statistics for table %q\n", table)
+		stats, err := tablestats.Capture(ctx, r.db, table, scopeColumnsByTable[table])
+		if err != nil {
+			fmt.Printf("Error capturing table statistics: %v\n", err)
+			continue
+		}
+		fmt.Printf(
+			"Table %q: %d rows, %d bytes, %d bytes of indexes\n",
+			stats.Name,
+			stats.RowCount,
+			stats.TableSize,
+			stats.IndexesSize,
+		)
+		result = append(result, stats)
+	}
+	return result
+}
+
+// ProfileQuery fills the entry with the execution plan of the request and
+// the pg_stat_statements activity recorded while profiling it.
+func (r *Runner) ProfileQuery(ctx context.Context, entry *report.Entry, request *query.Query) *report.Entry {
+	entry.Statement, _ = request.ForExecution()
+	entry.CacheMode = r.options.CacheMode
+	if interrupted(ctx, entry) {
+		return entry
+	}
+	err := r.prepareCache(ctx, request)
+	if err != nil {
+		fmt.Printf("Error preparing buffer cache: %v\n", err)
+		entry.Error = err.Error()
+		return entry
+	}
+	return r.measure(ctx, r.db, entry, request)
+}
+
+// ProfileScopeTable fills the entry with the execution plan of the request
+// filtered by the temporary scope table, created with the scope of the query
+// in a transaction rolled back afterwards.
+func (r *Runner) ProfileScopeTable(ctx context.Context, entry *report.Entry, request *query.Query, q *query.Query, namespaces []scope.ScopeNamespace) *report.Entry {
+	entry.Statement, _ = request.ForExecution()
+	entry.CacheMode = r.options.CacheMode
+	if interrupted(ctx, entry) {
+		return entry
+	}
+	err := r.prepareCache(ctx, request)
+	if err != nil {
+		fmt.Printf("Error preparing buffer cache: %v\n", err)
+		entry.Error = err.Error()
+		return entry
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		fmt.Printf("Error beginning transaction: %v\n", err)
+		entry.Error = err.Error()
+		return entry
+	}
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+	if err = rls.CreateScopeTable(ctx, tx, fallbackScopeTable, q, namespaces); err != nil {
+		fmt.Printf("Error creating scope table: %v\n", err)
+		entry.Error = err.Error()
+		return entry
+	}
+	return r.measure(ctx, tx, entry, request)
+}
+
+// ProfileRLS fills the entry with the execution plan of the unmodified
+// request, run in a session where a row-level security policy restricts
+// the scope table to the scope.
+func (r *Runner) ProfileRLS(ctx context.Context, entry *report.Entry, request *query.Query, namespaces []scope.ScopeNamespace) *report.Entry {
+	entry.Statement, _ = request.ForExecution()
+	entry.CacheMode = r.options.CacheMode
+	if interrupted(ctx, entry) {
+		return entry
+	}
+	// The cache is prepared before the session locks the scope table.
+	err := r.prepareCache(ctx, request)
+	if err != nil {
+		fmt.Printf("Error preparing buffer cache: %v\n", err)
+		entry.Error = err.Error()
+		return entry
+	}
+	session, err := rls.Begin(ctx, r.db, request, namespaces)
+	if err != nil {
+		fmt.Printf("Error setting up row-level security: %v\n", err)
+		entry.Error = err.Error()
+		return entry
+	}
+	defer func() {
+		if err := session.Close(context.WithoutCancel(ctx)); err != nil {
+			fmt.Printf("Error closing row-level security session: %v\n", err)
+		}
+	}()
+	return r.measure(ctx, session.DB(), entry, request)
+}
+
+// measure runs the request on the database, which may be a session of the
+// runner database, and records its executions. The pg_stat_statements
+// snapshots are taken on the runner database.
+func (r *Runner) measure(ctx context.Context, database db.DB, entry *report.Entry, request *query.Query) *report.Entry {
+	before, err := statements.Take(ctx, r.db)
+	if err != nil {
+		fmt.Printf("Error taking pg_stat_statements snapshot: %v\n", err)
+	}
+	for iteration := 1; iteration <= r.options.Executions; iteration++ {
+		stmtCtx, cancel := r.statementContext(ctx)
+		plan, err := explainQuery(stmtCtx, database, request)
+		if err != nil {
+			failure(stmtCtx, entry, err)
+			cancel()
+			fmt.Printf("Error querying for execution plan: %s\n", entry.Error)
+			break
+		}
+		cancel()
+		if iteration == 1 {
+			entry.Plan = plan
+			fmt.Println(string(plan.Raw))
+		}
+		execution := report.Execution{
+			Iteration:        iteration,
+			PlanningTime:     plan.PlanningTime,
+			ExecutionTime:    plan.ExecutionTime,
+			SharedHitBlocks:  plan.Plan.SharedHitBlocks,
+			SharedReadBlocks: plan.Plan.SharedReadBlocks,
+		}
+		fmt.Printf(
+			"Execution %d: planning %.3f ms, execution %.3f ms, %d shared hits, %d shared reads\n",
+			execution.Iteration,
+			execution.PlanningTime,
+			execution.ExecutionTime,
+			execution.SharedHitBlocks,
+			execution.SharedReadBlocks,
+		)
+		entry.Executions = append(entry.Executions, execution)
+	}
+	// The snapshots are taken around the executions only, the verification
+	// and the generic plan analysis are not counted.
+	if before != nil {
+		r.recordStatements(ctx, entry, before)
+	}
+	if r.options.Verify && entry.Injection != report.InjectionNone && entry.Error == "" {
+		stmt, bindValues := request.ForExecution()
+		stmtCtx, cancel := r.statementContext(ctx)
+		entry.Verification, err = verify.Run(stmtCtx, database, stmt, bindValues...)
+		if err != nil {
+			failure(stmtCtx, entry, err)
+			fmt.Printf("Error verifying result set: %s\n", entry.Error)
+		} else {
+			fmt.Printf("Result set: %d rows, checksum %s\n", entry.Verification.Rows, entry.Verification.Checksum)
+		}
+		cancel()
+	}
+	// The statements with inlined literals have no parameter to plan
+	// generically.
+	if r.options.GenericPlans && entry.Injection != report.InjectionNone && entry.Rendering != report.RenderingLiterals && entry.Error == "" {
+		fmt.Printf("Analyzing generic plan for %d %s namespaces\n", entry.ScopeSize, entry.Selection)
+		// The analysis runs the executions, then the custom and the generic
+		// plans.
+		stmtCtx, cancel := r.statementsContext(ctx, r.options.PreparedExecutions+2)
+		entry.GenericPlan, err = r.analyzeGenericPlan(stmtCtx, database, request)
+		if err != nil {
+			failure(stmtCtx, entry, err)
+			fmt.Printf("Error analyzing generic plan: %s\n", entry.Error)
+		}
+		cancel()
+	}
+	return entry
+}
+
+// recordStatements records the pg_stat_statements counters of the
+// executions since the snapshot taken before them.
+func (r *Runner) recordStatements(ctx context.Context, entry *report.Entry, before statements.Snapshot) {
+	after, err := statements.Take(ctx, r.db)
+	if err != nil {
+		fmt.Printf("Error taking pg_stat_statements snapshot: %v\n", err)
+		return
+	}
+	entry.Statements = before.Delta(after)
+	fmt.Printf(
+		"pg_stat_statements: %d calls, %.3f ms total, %d rows, %d shared hits, %d shared reads, %d temp reads\n",
+		entry.Statements.Calls,
+		entry.Statements.TotalExecTime,
+		entry.Statements.Rows,
+		entry.Statements.SharedBlksHit,
+		entry.Statements.SharedBlksRead,
+		entry.Statements.TempBlksRead,
+	)
+}
+
+func explainQuery(ctx context.Context, database db.DB, request *query.Query) (*explain.Plan, error) {
+	stmt, bindValues := request.ForExecution()
+	return explain.Run(ctx, database, stmt, bindValues...)
+}
+
+func (r *Runner) prepareCache(ctx context.Context, request *query.Query) error {
+	switch r.options.CacheMode {
+	case cache.ModePrewarm:
+		return cache.Prewarm(ctx, r.db, request.Tables())
+	case cache.ModeEvict:
+		if r.evictor == nil {
+			return errors.New("no cache evictor")
+		}
+		return r.evictor.Evict(ctx)
+	default:
+		return nil
+	}
+}
+
+func (r *Runner) analyzeGenericPlan(ctx context.Context, database db.DB, request *query.Query) (*prepared.Analysis, error) {
+	analysis, err := prepared.Analyze(ctx, database, request, r.options.PreparedExecutions)
+	if err != nil {
+		return nil, err
+	}
+	for _, execution := range analysis.Executions {
+		fmt.Printf(
+			"Execution %d: generic plan %t, planning %.3f ms, execution %.3f ms\n",
+			execution.Iteration,
+			execution.Generic,
+			execution.PlanningTime,
+			execution.ExecutionTime,
+		)
+	}
+	if analysis.GenericPlanChosenAt > 0 {
+		fmt.Printf("Generic plan chosen at execution %d\n", analysis.GenericPlanChosenAt)
+	} else {
+		fmt.Printf("Generic plan not chosen in %d executions\n", len(analysis.Executions))
+	}
+	fmt.Printf(
+		"Custom plan: planning %.3f ms, execution %.3f ms\n",
+		analysis.CustomPlan.PlanningTime,
+		analysis.CustomPlan.ExecutionTime,
+	)
+	fmt.Println(string(analysis.CustomPlan.Raw))
+	fmt.Printf(
+		"Generic plan: planning %.3f ms, execution %.3f ms\n",
+		analysis.GenericPlan.PlanningTime,
+		analysis.GenericPlan.ExecutionTime,
+	)
+	fmt.Println(string(analysis.GenericPlan.Raw))
+	return analysis, nil
+}
@@ -0,0 +1,598 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/cache"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db/dbtest"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/report"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/scope"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/verify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const samplePlan = `[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "alerts",
+"Shared Hit Blocks": 7, "Shared Read Blocks": 2}, "Planning Time": 0.5, "Execution Time": 2.5}]`
+
+var alertsCount = &query.Query{
+	Name:                 "alerts-count",
+	Statement:            "select",
+	StatementTargets:     []query.Target{query.Raw("count(*)")},
+	TargetTables:         []string{"alerts"},
+	WhereClause:          &query.QualifiedColumn{TableName: "alerts", ColumnName: "State", Value: 0},
+	ScopeLevel:           "namespace",
+	ScopeTable:           "alerts",
+	ScopeClusterColumn:   "ClusterId",
+	ScopeNamespaceColumn: "Namespace",
+}
+
+func countStatements(statements []string, prefix string) int {
+	count := 0
+	for _, stmt := range statements {
+		if strings.HasPrefix(stmt, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestProfileQuery(t *testing.T) {
+	fake := dbtest.New().On("explain", dbtest.Result{Rows: [][]any{{samplePlan}}})
+	r := New(fake, Options{Executions: 3, CacheMode: cache.ModePrewarm})
+
+	entry := r.ProfileQuery(context.Background(), &report.Entry{Query: "alerts-count"}, alertsCount)
+	assert.Empty(t, entry.Error)
+	assert.Equal(t, "select count(*) from alerts where alerts.State = $1", entry.Statement)
+	assert.Equal(t, cache.ModePrewarm, entry.CacheMode)
+	require.NotNil(t, entry.Plan)
+	assert.Equal(t, "Seq Scan", entry.Plan.Plan.NodeType)
+	require.Len(t, entry.Executions, 3)
+	assert.Equal(t, report.Execution{
+		Iteration:        3,
+		PlanningTime:     0.5,
+		ExecutionTime:    2.5,
+		SharedHitBlocks:  7,
+		SharedReadBlocks: 2,
+	}, entry.Executions[2])
+	require.NotNil(t, entry.Statements)
+	assert.Zero(t, entry.Statements.Calls)
+
+	statements := fake.Statements()
+	assert.Equal(t, 3, countStatements(statements, "explain "))
+	assert.Equal(t, 1, countStatements(statements, "select pg_prewarm"))
+}
+
+func TestProfileQueryError(t *testing.T) {
+	failure := errors.New("canceling statement due to statement timeout")
+	fake := dbtest.New().On("explain", dbtest.Result{Err: failure})
+	r := New(fake, Options{Executions: 3, CacheMode: cache.ModeNone})
+
+	entry := r.ProfileQuery(context.Background(), &report.Entry{Query: "alerts-count"}, alertsCount)
+	assert.Equal(t, failure.Error(), entry.Error)
+	assert.Nil(t, entry.Plan)
+	assert.Empty(t, entry.Executions)
+	assert.Equal(t, 1, countStatements(fake.Statements(), "explain "))
+}
+
+func TestDiscoverNamespaces(t *testing.T) {
+	fake := dbtest.New().
+		On(namespaceCountStatement, dbtest.Result{Rows: [][]any{{3}}}).
+		On(namespacesStatement, dbtest.Result{Rows: [][]any{
+			{"cluster-1", "default"},
+			{"cluster-2", "default"},
+			{"cluster-1", "payments"},
+		}})
+	namespaces, err := New(fake, Options{}).DiscoverNamespaces(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"cluster-1": {"default", "payments"},
+		"cluster-2": {"default"},
+	}, namespaces)
+
+	failure := errors.New("relation \"namespaces\" does not exist")
+	fake = dbtest.New().On(namespaceCountStatement, dbtest.Result{Err: failure})
+	_, err = New(fake, Options{}).DiscoverNamespaces(context.Background())
+	assert.ErrorIs(t, err, failure)
+}
+
+func TestRun(t *testing.T) {
+	fake := dbtest.New().
+		On("explain", dbtest.Result{Rows: [][]any{{samplePlan}}}).
+		On("count(*) filter", dbtest.Result{Rows: [][]any{{int64(4), int64(16)}}})
+	r := New(fake, Options{Executions: 1, CacheMode: cache.ModeNone})
+	selections := []Selection{
+		{
+			Name: report.SelectionOrdered,
+			Scopes: [][]scope.ScopeNamespace{
+				{{ClusterID: "cluster-1", NamespaceName: "default"}},
+				{{ClusterID: "cluster-1", NamespaceName: "default"}, {ClusterID: "cluster-2", NamespaceName: "default"}},
+			},
+		},
+	}
+	queries := []*query.Query{alertsCount}
+
+	entries := make([]*report.Entry, 0)
+	err := r.Run(context.Background(), queries, selections, func(entry *report.Entry) {
+		entries = append(entries, entry)
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, r.PlannedEntries(queries, selections))
+	assert.Equal(t, report.SelectionNone, entries[0].Selection)
+	assert.Equal(t, report.InjectionNone, entries[0].Injection)
+	for i, size := range []int{1, 2} {
+		entry := entries[i+1]
+		assert.Equal(t, "alerts-count", entry.Query)
+		assert.Equal(t, report.SelectionOrdered, entry.Selection)
+		assert.Equal(t, report.InjectionOrTree, entry.Injection)
+		assert.Equal(t, size, entry.ScopeSize)
+		assert.Contains(t, entry.Statement, "alerts.ClusterId = $1")
+		require.NotNil(t, entry.ScopeStats)
+		assert.Equal(t, size, entry.ScopeStats.Clusters)
+		assert.Equal(t, 0.25, entry.ScopeStats.RowFraction)
+	}
+	assert.Nil(t, entries[0].ScopeStats)
+
+	entries = entries[:0]
+	err = r.Run(context.Background(), []*query.Query{alertsCount, alertsCount}, selections, func(entry *report.Entry) {
+		entries = append(entries, entry)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, countStatements(fake.Statements(), "select count(*) filter"), "the statistics are computed once per scope table")
+}
+
+func TestRunScopePath(t *testing.T) {
+	fake := dbtest.New().On("explain", dbtest.Result{Rows: [][]any{{samplePlan}}})
+	r := New(fake, Options{Executions: 1, CacheMode: cache.ModeNone})
+	imagesCount := &query.Query{
+		Name:             "images-count",
+		Statement:        "select",
+		StatementTargets: []query.Target{query.Raw("count(*)")},
+		TargetTables:     []string{"images"},
+		ScopeLevel:       "cluster",
+		ScopeTable:       "deployments",
+		ScopeJoins: []query.InnerJoin{
+			{
+				Left:  query.QualifiedColumn{TableName: "images", ColumnName: "Id"},
+				Right: query.QualifiedColumn{TableName: "deployments", ColumnName: "Image_Id"},
+			},
+		},
+		ScopeClusterColumn: "ClusterId",
+	}
+	selections := []Selection{
+		{
+			Name:   report.SelectionOrdered,
+			Scopes: [][]scope.ScopeNamespace{{{ClusterID: "cluster-1", NamespaceName: "default"}}},
+		},
+	}
+	queries := []*query.Query{imagesCount, alertsCount}
+
+	entries := make([]*report.Entry, 0)
+	err := r.Run(context.Background(), queries, selections, func(entry *report.Entry) {
+		entries = append(entries, entry)
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, r.PlannedEntries(queries, selections))
+	require.Len(t, entries, 5)
+	assert.Equal(t, report.InjectionOrTree, entries[1].Injection)
+	assert.Equal(
+		t,
+		"select count(*) from images inner join deployments on images.Id = deployments.Image_Id where ( deployments.ClusterId = $1 )",
+		entries[1].Statement,
+	)
+	assert.Equal(t, report.InjectionExists, entries[2].Injection)
+	assert.Equal(
+		t,
+		"select count(*) from images where exists ( select 1 from deployments where images.Id = deployments.Image_Id and ( deployments.ClusterId = $1 ) )",
+		entries[2].Statement,
+	)
+	assert.Equal(t, report.InjectionOrTree, entries[4].Injection)
+}
+
+func TestRunCompareCasts(t *testing.T) {
+	fake := dbtest.New().On("explain", dbtest.Result{Rows: [][]any{{samplePlan}}})
+	r := New(fake, Options{Executions: 1, CacheMode: cache.ModeNone, CompareCasts: true})
+	typed := *alertsCount
+	typed.ScopeClusterType = "uuid"
+	selections := []Selection{
+		{
+			Name:   report.SelectionOrdered,
+			Scopes: [][]scope.ScopeNamespace{{{ClusterID: "cluster-1", NamespaceName: "default"}}},
+		},
+	}
+	queries := []*query.Query{&typed, alertsCount}
+
+	entries := make([]*report.Entry, 0)
+	err := r.Run(context.Background(), queries, selections, func(entry *report.Entry) {
+		entries = append(entries, entry)
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, r.PlannedEntries(queries, selections))
+	require.Len(t, entries, 5)
+	assert.Equal(t, report.RenderingDefault, entries[1].Rendering)
+	assert.Equal(
+		t,
+		"select count(*) from alerts where ( ( ( alerts.ClusterId = $1::uuid and ( alerts.Namespace = $2 ) ) ) and alerts.State = $3 )",
+		entries[1].Statement,
+	)
+	assert.Equal(t, report.RenderingNoCasts, entries[2].Rendering)
+	assert.Equal(
+		t,
+		"select count(*) from alerts where ( ( ( alerts.ClusterId = $1 and ( alerts.Namespace = $2 ) ) ) and alerts.State = $3 )",
+		entries[2].Statement,
+	)
+	assert.Equal(t, report.RenderingDefault, entries[4].Rendering, "untyped queries are rendered once")
+}
+
+func TestRunCompareLiterals(t *testing.T) {
+	fake := dbtest.New().On("explain", dbtest.Result{Rows: [][]any{{samplePlan}}})
+	r := New(fake, Options{Executions: 1, CacheMode: cache.ModeNone, CompareLiterals: true})
+	selections := []Selection{
+		{
+			Name:   report.SelectionOrdered,
+			Scopes: [][]scope.ScopeNamespace{{{ClusterID: "cluster-1", NamespaceName: "default"}}},
+		},
+	}
+	queries := []*query.Query{alertsCount}
+
+	entries := make([]*report.Entry, 0)
+	err := r.Run(context.Background(), queries, selections, func(entry *report.Entry) {
+		entries = append(entries, entry)
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, r.PlannedEntries(queries, selections))
+	require.Len(t, entries, 3)
+	assert.Equal(t, report.RenderingLiterals, entries[2].Rendering)
+	assert.Equal(
+		t,
+		"select count(*) from alerts where ( ( ( alerts.ClusterId = 'cluster-1' and ( alerts.Namespace = 'default' ) ) ) and alerts.State = 0 )",
+		entries[2].Statement,
+	)
+}
+
+func TestRunVerify(t *testing.T) {
+	fake := dbtest.New().
+		On("explain", dbtest.Result{Rows: [][]any{{samplePlan}}}).
+		On("format_type", dbtest.Result{Rows: [][]any{{"uuid", "character varying"}}}).
+		On("md5", dbtest.Result{Rows: [][]any{{int64(1), "a"}}})
+	r := New(fake, Options{Executions: 1, CacheMode: cache.ModeNone, RLS: true, Verify: true, VerifyReference: report.InjectionRLS})
+	selections := []Selection{
+		{
+			Name:   report.SelectionOrdered,
+			Scopes: [][]scope.ScopeNamespace{{{ClusterID: "cluster-1", NamespaceName: "default"}}},
+		},
+	}
+
+	entries := make([]*report.Entry, 0)
+	err := r.Run(context.Background(), []*query.Query{alertsCount}, selections, func(entry *report.Entry) {
+		entries = append(entries, entry)
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Nil(t, entries[0].Verification)
+	assert.Equal(t, &verify.Result{Rows: 1, Checksum: "a", Reference: report.InjectionRLS, Match: true}, entries[1].Verification)
+	assert.Equal(t, &verify.Result{Rows: 1, Checksum: "a"}, entries[2].Verification)
+
+	mismatching := dbtest.New().
+		On("explain", dbtest.Result{Rows: [][]any{{samplePlan}}}).
+		On("format_type", dbtest.Result{Rows: [][]any{{"uuid", "character varying"}}}).
+		On("( alerts.ClusterId = $1", dbtest.Result{Rows: [][]any{{int64(2), "b"}}}).
+		On("md5", dbtest.Result{Rows: [][]any{{int64(1), "a"}}})
+	r = New(mismatching, Options{Executions: 1, CacheMode: cache.ModeNone, RLS: true, Verify: true, VerifyReference: report.InjectionRLS})
+	entries = entries[:0]
+	err = r.Run(context.Background(), []*query.Query{alertsCount}, selections, func(entry *report.Entry) {
+		entries = append(entries, entry)
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, &verify.Result{Rows: 2, Checksum: "b", Reference: report.InjectionRLS}, entries[1].Verification)
+
+	// The pages of a paginated query are summarized, not compared.
+	paginated := *alertsCount
+	paginated.QueryPagination = &query.Pagination{Limit: 10}
+	entries = entries[:0]
+	err = r.Run(context.Background(), []*query.Query{&paginated}, selections, func(entry *report.Entry) {
+		entries = append(entries, entry)
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, &verify.Result{Rows: 2, Checksum: "b"}, entries[1].Verification)
+	assert.Equal(t, &verify.Result{Rows: 1, Checksum: "a"}, entries[2].Verification)
+}
+
+func TestRunBindFallback(t *testing.T) {
+	namespaces := make([]scope.ScopeNamespace, 0, query.MaxBindParameters+1)
+	for ix := 0; ix <= query.MaxBindParameters; ix++ {
+		namespaces = append(namespaces, scope.ScopeNamespace{ClusterID: "cluster-1", NamespaceName: fmt.Sprintf("ns-%d", ix)})
+	}
+	selections := []Selection{{Name: report.SelectionOrdered, Scopes: [][]scope.ScopeNamespace{namespaces}}}
+	typed := *alertsCount
+	typed.ScopeClusterType = "uuid"
+	typed.ScopeNamespaceType = "varchar"
+
+	for name, tc := range map[string]struct {
+		query     *query.Query
+		fallback  string
+		statement string
+	}{
+		"array": {
+			query:    &typed,
+			fallback: report.FallbackArray,
+			statement: "select count(*) from alerts where ( ( alerts.ClusterId, alerts.Namespace ) in" +
+				" ( select c::uuid, n::varchar from unnest($1::text[], $2::text[]) as u(c, n) ) and alerts.State = $3 )",
+		},
+		"temp table": {
+			query:    alertsCount,
+			fallback: report.FallbackTable,
+			statement: "select count(*) from alerts where ( ( alerts.ClusterId, alerts.Namespace ) in" +
+				" ( select clusterid, namespace from sacsqlperf_fallback_scope ) and alerts.State = $1 )",
+		},
+	} {
+		fake := dbtest.New().
+			On("explain", dbtest.Result{Rows: [][]any{{samplePlan}}}).
+			On("format_type", dbtest.Result{Rows: [][]any{{"uuid", "character varying"}}})
+		// The statements falling back are not rendered without casts.
+		r := New(fake, Options{Executions: 1, CacheMode: cache.ModeNone, CompareCasts: true})
+		entries := make([]*report.Entry, 0)
+		err := r.Run(context.Background(), []*query.Query{tc.query}, selections, func(entry *report.Entry) {
+			entries = append(entries, entry)
+		})
+		require.NoError(t, err, name)
+		require.Len(t, entries, 2, name)
+		assert.Equal(t, 2, r.PlannedEntries([]*query.Query{tc.query}, selections), name)
+		assert.Equal(t, tc.fallback, entries[1].Fallback, name)
+		assert.Equal(t, tc.statement, entries[1].Statement, name)
+		assert.Empty(t, entries[1].Error, name)
+		created := countStatements(fake.Statements(), "create table sacsqlperf_fallback_scope")
+		if tc.fallback == report.FallbackTable {
+			assert.Equal(t, 1, created, name)
+		} else {
+			assert.Zero(t, created, name)
+		}
+	}
+}
+
+// blockingDB holds the statements containing match until their context is
+// done, like a server running a pathological plan.
+type blockingDB struct {
+	*dbtest.DB
+	match string
+}
+
+type errorRow struct {
+	err error
+}
+
+func (r errorRow) Scan(_ ...any) error {
+	return r.err
+}
+
+func (b *blockingDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if strings.Contains(sql, b.match) {
+		<-ctx.Done()
+		return errorRow{err: ctx.Err()}
+	}
+	return b.DB.QueryRow(ctx, sql, args...)
+}
+
+func TestRunTimeouts(t *testing.T) {
+	selections := []Selection{
+		{
+			Name: report.SelectionOrdered,
+			Scopes: [][]scope.ScopeNamespace{
+				{{ClusterID: "cluster-1", NamespaceName: "default"}},
+				{{ClusterID: "cluster-1", NamespaceName: "default"}, {ClusterID: "cluster-2", NamespaceName: "default"}},
+			},
+		},
+	}
+	blocked := "alerts.ClusterId"
+	newDB := func() *blockingDB {
+		return &blockingDB{DB: dbtest.New().On("explain", dbtest.Result{Rows: [][]any{{samplePlan}}}), match: blocked}
+	}
+	run := func(ctx context.Context, options Options) ([]*report.Entry, error) {
+		entries := make([]*report.Entry, 0)
+		err := New(newDB(), options).Run(ctx, []*query.Query{alertsCount}, selections, func(entry *report.Entry) {
+			entries = append(entries, entry)
+		})
+		return entries, err
+	}
+
+	entries, err := run(context.Background(), Options{Executions: 1, CacheMode: cache.ModeNone, StatementTimeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Empty(t, entries[0].Status)
+	for _, entry := range entries[1:] {
+		assert.Equal(t, report.StatusTimeout, entry.Status)
+		assert.Equal(t, ErrStatementTimeout.Error(), entry.Error)
+	}
+
+	entries, err = run(context.Background(), Options{Executions: 1, CacheMode: cache.ModeNone, QueryBudget: 20 * time.Millisecond})
+	require.NoError(t, err, "an exhausted query budget does not stop the run")
+	require.Len(t, entries, 3)
+	assert.Equal(t, report.StatusTimeout, entries[1].Status)
+	assert.Equal(t, ErrQueryBudget.Error(), entries[1].Error)
+	assert.Equal(t, report.StatusSkipped, entries[2].Status)
+
+	ctx, cancel := context.WithTimeoutCause(context.Background(), 20*time.Millisecond, ErrRunBudget)
+	defer cancel()
+	entries, err = run(ctx, Options{Executions: 1, CacheMode: cache.ModeNone})
+	require.ErrorIs(t, err, ErrRunBudget)
+	require.Len(t, entries, 2, "the run stops at the interruption")
+	assert.Equal(t, report.StatusCancelled, entries[1].Status)
+	assert.Equal(t, ErrRunBudget.Error(), entries[1].Error)
+
+	// The verification of the result set is bounded like the executions.
+	blocked = "string_agg"
+	entries, err = run(context.Background(), Options{Executions: 1, CacheMode: cache.ModeNone, Verify: true, StatementTimeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	for _, entry := range entries[1:] {
+		assert.Len(t, entry.Executions, 1)
+		assert.Nil(t, entry.Verification)
+		assert.Equal(t, report.StatusTimeout, entry.Status)
+		assert.Equal(t, ErrStatementTimeout.Error(), entry.Error)
+	}
+}
+
+func TestRunGenericPlanError(t *testing.T) {
+	selections := []Selection{
+		{
+			Name:   report.SelectionOrdered,
+			Scopes: [][]scope.ScopeNamespace{{{ClusterID: "cluster-1", NamespaceName: "default"}}},
+		},
+	}
+	failure := errors.New("out of memory")
+	fake := dbtest.New().
+		On("explain", dbtest.Result{Rows: [][]any{{samplePlan}}}).
+		On("pg_prepared_statements", dbtest.Result{Rows: [][]any{{0}}}).
+		On("prepare sacsqlperf_prepared", dbtest.Result{Err: failure})
+	entries := make([]*report.Entry, 0)
+	r := New(fake, Options{Executions: 1, CacheMode: cache.ModeNone, GenericPlans: true, PreparedExecutions: 2})
+	err := r.Run(context.Background(), []*query.Query{alertsCount}, selections, func(entry *report.Entry) {
+		entries = append(entries, entry)
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Empty(t, entries[0].Error)
+	assert.Nil(t, entries[1].GenericPlan)
+	assert.Contains(t, entries[1].Error, failure.Error())
+	assert.Empty(t, entries[1].Status)
+}
+
+func TestValidate(t *testing.T) {
+	selections := []Selection{
+		{
+			Name:   report.SelectionOrdered,
+			Scopes: [][]scope.ScopeNamespace{{{ClusterID: "cluster-1", NamespaceName: "default"}}},
+		},
+	}
+	fake := dbtest.New().
+		On("pg_prepared_statements", dbtest.Result{Rows: [][]any{{0}}}).
+		On("format_type", dbtest.Result{Rows: [][]any{{"text", "text"}}})
+	r := New(fake, Options{})
+	require.NoError(t, r.Validate(context.Background(), []*query.Query{alertsCount}, selections))
+	assert.Equal(t, []string{
+		"prepare sacsqlperf_prepared as select count(*) from alerts where alerts.State = $1",
+		"prepare sacsqlperf_prepared as select count(*) from alerts where ( ( ( alerts.ClusterId = $1 and ( alerts.Namespace = $2 ) ) ) and alerts.State = $3 )",
+		"prepare sacsqlperf_prepared as select count(*) from alerts where ( ( alerts.ClusterId, alerts.Namespace ) in ( select clusterid, namespace from sacsqlperf_fallback_scope ) and alerts.State = $1 )",
+	}, prepareStatements(fake.Statements()))
+	// The scope table of the fallback is created in a transaction rolled back afterwards.
+	assert.Equal(t, 1, countStatements(fake.Statements(), "create table sacsqlperf_fallback_scope"))
+	assert.Equal(t, dbtest.StatementRollback, fake.Statements()[len(fake.Statements())-1])
+
+	failure := errors.New(`syntax error at or near "group"`)
+	fake = dbtest.New().
+		On("pg_prepared_statements", dbtest.Result{Rows: [][]any{{0}}}).
+		On("alerts.ClusterId", dbtest.Result{Err: failure})
+	r = New(fake, Options{})
+	err := r.Validate(context.Background(), []*query.Query{alertsCount}, selections)
+	assert.ErrorIs(t, err, failure)
+	assert.Contains(t, err.Error(), `query "alerts-count" with or-tree injection`)
+}
+
+func TestValidateRenderings(t *testing.T) {
+	selections := []Selection{
+		{
+			Name:   report.SelectionOrdered,
+			Scopes: [][]scope.ScopeNamespace{{{ClusterID: "cluster-1", NamespaceName: "default"}}},
+		},
+	}
+	typed := *alertsCount
+	typed.ScopeClusterType = "uuid"
+	typed.ScopeNamespaceType = "varchar"
+	fake := dbtest.New().
+		On("pg_prepared_statements", dbtest.Result{Rows: [][]any{{0}}}).
+		On("format_type", dbtest.Result{Rows: [][]any{{"uuid", "character varying"}}})
+	r := New(fake, Options{CompareCasts: true, CompareLiterals: true, RLS: true})
+	require.NoError(t, r.Validate(context.Background(), []*query.Query{&typed}, selections))
+	array := "( alerts.ClusterId, alerts.Namespace ) in ( select c::uuid, n::varchar from unnest($1::text[], $2::text[]) as u(c, n) )"
+	assert.Equal(t, []string{
+		"prepare sacsqlperf_prepared as select count(*) from alerts where alerts.State = $1",
+		"prepare sacsqlperf_prepared as select count(*) from alerts where ( ( ( alerts.ClusterId = $1::uuid and ( alerts.Namespace = $2::varchar ) ) ) and alerts.State = $3 )",
+		"prepare sacsqlperf_prepared as select count(*) from alerts where ( ( ( alerts.ClusterId = $1 and ( alerts.Namespace = $2 ) ) ) and alerts.State = $3 )",
+		"prepare sacsqlperf_prepared as select count(*) from alerts where ( ( ( alerts.ClusterId = 'cluster-1'::uuid and ( alerts.Namespace = 'default'::varchar ) ) ) and alerts.State = 0 )",
+		"prepare sacsqlperf_prepared as select count(*) from alerts where ( " + array + " and alerts.State = $3 )",
+		"prepare sacsqlperf_prepared as select count(*) from alerts where ( ( alerts.ClusterId, alerts.Namespace ) in ( select c::uuid, n::varchar" +
+			` from unnest('{"cluster-1"}'::text[], '{"default"}'::text[]) as u(c, n) ) and alerts.State = 0 )`,
+		"prepare sacsqlperf_prepared as select count(*) from alerts where alerts.State = $1",
+	}, prepareStatements(fake.Statements()))
+	// The unmodified query is prepared in the row-level security session.
+	assert.Equal(t, 1, countStatements(fake.Statements(), "create policy"))
+	assert.Equal(t, 1, countStatements(fake.Statements(), "set local role"))
+
+	failure := errors.New(`role "sacsqlperf_rls" already exists`)
+	fake = dbtest.New().
+		On("pg_prepared_statements", dbtest.Result{Rows: [][]any{{0}}}).
+		On("format_type", dbtest.Result{Rows: [][]any{{"uuid", "character varying"}}}).
+		On("create role", dbtest.Result{Err: failure})
+	r = New(fake, Options{RLS: true})
+	err := r.Validate(context.Background(), []*query.Query{&typed}, selections)
+	assert.ErrorIs(t, err, failure)
+	assert.Contains(t, err.Error(), `row-level security set-up for query "alerts-count"`)
+}
+
+func prepareStatements(statements []string) []string {
+	result := make([]string, 0)
+	for _, stmt := range statements {
+		if strings.HasPrefix(stmt, "prepare ") {
+			result = append(result, stmt)
+		}
+	}
+	return result
+}
+
+func TestRunEvict(t *testing.T) {
+	fake := dbtest.New().
+		On("shared_buffers", dbtest.Result{Rows: [][]any{{int64(16)}}}).
+		On("explain", dbtest.Result{Rows: [][]any{{samplePlan}}})
+	r := New(fake, Options{Executions: 2, CacheMode: cache.ModeEvict})
+
+	err := r.Run(context.Background(), []*query.Query{alertsCount}, nil, func(entry *report.Entry) {
+		assert.Empty(t, entry.Error)
+	})
+	require.NoError(t, err)
+	statements := fake.Statements()
+	assert.Equal(t, 1, countStatements(statements, "create unlogged table"))
+	assert.Equal(t, 1, countStatements(statements, "select pg_prewarm('sacsqlperf_eviction', 'buffer')"))
+	assert.Equal(t, "drop table if exists sacsqlperf_eviction", statements[len(statements)-1])
+}
+
+func TestRunRLS(t *testing.T) {
+	fake := dbtest.New().
+		On("explain", dbtest.Result{Rows: [][]any{{samplePlan}}}).
+		On("format_type", dbtest.Result{Rows: [][]any{{"uuid", "character varying"}}})
+	r := New(fake, Options{Executions: 1, CacheMode: cache.ModeNone, RLS: true})
+	selections := []Selection{
+		{
+			Name:   report.SelectionOrdered,
+			Scopes: [][]scope.ScopeNamespace{{{ClusterID: "cluster-1", NamespaceName: "default"}}},
+		},
+	}
+	queries := []*query.Query{alertsCount}
+
+	entries := make([]*report.Entry, 0)
+	err := r.Run(context.Background(), queries, selections, func(entry *report.Entry) {
+		entries = append(entries, entry)
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, r.PlannedEntries(queries, selections))
+	require.Len(t, entries, 3)
+	rlsEntry := entries[2]
+	assert.Empty(t, rlsEntry.Error)
+	assert.Equal(t, report.InjectionRLS, rlsEntry.Injection)
+	assert.Equal(t, 1, rlsEntry.ScopeSize)
+	assert.Equal(t, "select count(*) from alerts where alerts.State = $1", rlsEntry.Statement)
+	require.Len(t, rlsEntry.Executions, 1)
+
+	statements := fake.Statements()
+	assert.Equal(t, 1, countStatements(statements, "set local role"))
+	assert.Equal(t, 3, countStatements(statements, "explain "))
+	assert.Equal(t, dbtest.StatementRollback, statements[len(statements)-1])
+}
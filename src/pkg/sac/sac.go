@@ -0,0 +1,191 @@
+package sac
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/scope"
+)
+
+// InjectFilter returns a copy of the request restricted to the given scope,
+// with the clusters in order of first appearance in the scope. When the
+// request does not join its scope table, the joins of its scope path are
+// added to reach it.
+func InjectFilter(request *query.Query, scope []scope.ScopeNamespace) *query.Query {
+	return JoinFilter(request, scopeFilter(request, scope))
+}
+
+// InjectExists returns a copy of the request restricted to the given scope
+// by an exists subquery following the scope path of the request to its scope
+// table, leaving the joins of the request untouched. Requests joining their
+// scope table get the filter of InjectFilter.
+func InjectExists(request *query.Query, scope []scope.ScopeNamespace) *query.Query {
+	return ExistsFilter(request, scopeFilter(request, scope))
+}
+
+// JoinFilter returns a copy of the request restricted by the filter of its
+// scope table, joined like InjectFilter does. A nil filter leaves the request
+// unrestricted.
+func JoinFilter(request *query.Query, filter query.WhereClausePart) *query.Query {
+	if filter == nil {
+		return request
+	}
+	result := withFilter(request, filter)
+	if !request.ReachesScopeTable() {
+		result.InnerJoins = append(slices.Clone(request.InnerJoins), request.ScopeJoins...)
+	}
+	return result
+}
+
+// ExistsFilter returns a copy of the request restricted by the filter of its
+// scope table, checked in an exists subquery like InjectExists does. A nil
+// filter leaves the request unrestricted.
+func ExistsFilter(request *query.Query, filter query.WhereClausePart) *query.Query {
+	if filter == nil {
+		return request
+	}
+	if request.ReachesScopeTable() {
+		return withFilter(request, filter)
+	}
+	return withFilter(request, &query.WcExists{
+		Joins:     request.ScopeJoins,
+		Condition: filter,
+	})
+}
+
+// ArrayFilter restricts the scope table of the request to the scope with
+// arrays of cluster IDs and namespace names, bound as two parameters
+// whatever the size of the scope. The arrays are cast to the scope types of
+// the request, which must be set. It is nil when the request is not
+// restricted.
+func ArrayFilter(request *query.Query, scope []scope.ScopeNamespace) query.WhereClausePart {
+	if !restricted(request, scope) {
+		return nil
+	}
+	if request.ScopeLevel == "cluster" {
+		clusterIDs := make([]string, 0)
+		seen := make(map[string]struct{})
+		for _, ns := range scope {
+			if _, found := seen[ns.ClusterID]; !found {
+				seen[ns.ClusterID] = struct{}{}
+				clusterIDs = append(clusterIDs, ns.ClusterID)
+			}
+		}
+		return &query.WcIn{
+			Columns:  scopeColumns(request),
+			Subquery: fmt.Sprintf("select c::%s from unnest($$::text[]) as u(c)", request.ScopeClusterType),
+			Values:   []interface{}{clusterIDs},
+		}
+	}
+	clusterIDs := make([]string, 0, len(scope))
+	namespaceNames := make([]string, 0, len(scope))
+	for _, ns := range scope {
+		clusterIDs = append(clusterIDs, ns.ClusterID)
+		namespaceNames = append(namespaceNames, ns.NamespaceName)
+	}
+	return &query.WcIn{
+		Columns: scopeColumns(request),
+		Subquery: fmt.Sprintf(
+			"select c::%s, n::%s from unnest($$::text[], $$::text[]) as u(c, n)",
+			request.ScopeClusterType,
+			request.ScopeNamespaceType,
+		),
+		Values: []interface{}{clusterIDs, namespaceNames},
+	}
+}
+
+// TableFilter restricts the scope table of the request to the scope held
+// by a table of (clusterid, namespace) pairs, such as the ones created by
+// rls.CreateScopeTable. It is nil when the request is not restricted.
+func TableFilter(request *query.Query, scope []scope.ScopeNamespace, table string) query.WhereClausePart {
+	if !restricted(request, scope) {
+		return nil
+	}
+	subquery := fmt.Sprintf("select clusterid from %s", query.QuoteIdentifier(table))
+	if request.ScopeLevel == "namespace" {
+		subquery = fmt.Sprintf("select clusterid, namespace from %s", query.QuoteIdentifier(table))
+	}
+	return &query.WcIn{Columns: scopeColumns(request), Subquery: subquery}
+}
+
+func restricted(request *query.Query, scope []scope.ScopeNamespace) bool {
+	return request != nil && len(scope) > 0 && (request.ScopeLevel == "cluster" || request.ScopeLevel == "namespace")
+}
+
+func scopeColumns(request *query.Query) []query.QualifiedColumn {
+	columns := []query.QualifiedColumn{{TableName: request.ScopeTable, ColumnName: request.ScopeClusterColumn}}
+	if request.ScopeLevel == "namespace" {
+		columns = append(columns, query.QualifiedColumn{TableName: request.ScopeTable, ColumnName: request.ScopeNamespaceColumn})
+	}
+	return columns
+}
+
+// scopeFilter builds the or-tree restricting the scope table of the request
+// to the scope, nil when the request is not restricted.
+func scopeFilter(request *query.Query, scope []scope.ScopeNamespace) query.WhereClausePart {
+	if !restricted(request, scope) {
+		return nil
+	}
+	clusterIDs := make([]string, 0)
+	namespacesByCluster := make(map[string][]string, 0)
+	for _, ns := range scope {
+		if _, found := namespacesByCluster[ns.ClusterID]; !found {
+			clusterIDs = append(clusterIDs, ns.ClusterID)
+		}
+		namespacesByCluster[ns.ClusterID] = append(namespacesByCluster[ns.ClusterID], ns.NamespaceName)
+	}
+	whereClusters := make([]query.WhereClausePart, 0, len(namespacesByCluster))
+	for _, clusterID := range clusterIDs {
+		namespaces := namespacesByCluster[clusterID]
+		clusterColumnPart := &query.QualifiedColumn{
+			TableName:  request.ScopeTable,
+			ColumnName: request.ScopeClusterColumn,
+			Value:      clusterID,
+			Type:       request.ScopeClusterType,
+		}
+		switch request.ScopeLevel {
+		case "cluster":
+			whereClusters = append(whereClusters, clusterColumnPart)
+		case "namespace":
+			whereClusterNamespaces := make([]query.WhereClausePart, 0, len(namespaces))
+			for _, ns := range namespaces {
+				namespaceColumnPart := &query.QualifiedColumn{
+					TableName:  request.ScopeTable,
+					ColumnName: request.ScopeNamespaceColumn,
+					Value:      ns,
+					Type:       request.ScopeNamespaceType,
+				}
+				whereClusterNamespaces = append(whereClusterNamespaces, namespaceColumnPart)
+			}
+			whereClusters = append(whereClusters, &query.WcAnd{
+				Operands: []query.WhereClausePart{
+					clusterColumnPart,
+					&query.WcOr{
+						Operands: whereClusterNamespaces,
+					},
+				},
+			})
+		default:
+			continue
+		}
+	}
+	return &query.WcOr{
+		Operands: whereClusters,
+	}
+}
+
+func withFilter(request *query.Query, filter query.WhereClausePart) *query.Query {
+	result := *request
+	if request.WhereClause != nil {
+		result.WhereClause = &query.WcAnd{
+			Operands: []query.WhereClausePart{
+				filter,
+				request.WhereClause,
+			},
+		}
+	} else {
+		result.WhereClause = filter
+	}
+	return &result
+}
@@ -0,0 +1,88 @@
+package sac
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/scope"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "regenerate the golden files from the current output")
+
+var injections = map[string]func(*query.Query, []scope.ScopeNamespace) *query.Query{
+	"":       InjectFilter,
+	"exists": InjectExists,
+	"array": func(request *query.Query, scope []scope.ScopeNamespace) *query.Query {
+		return JoinFilter(request, ArrayFilter(request, scope))
+	},
+	"table-exists": func(request *query.Query, scope []scope.ScopeNamespace) *query.Query {
+		return ExistsFilter(request, TableFilter(request, scope, "sacsqlperf_scope"))
+	},
+}
+
+type goldenCase struct {
+	Query *query.Query           `json:"query"`
+	Scope []scope.ScopeNamespace `json:"scope"`
+	// Injection is the name of the injection to apply, the or-tree filter
+	// when empty.
+	Injection string `json:"injection,omitempty"`
+}
+
+func loadCase(t *testing.T, path string) *goldenCase {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	tc := &goldenCase{}
+	require.NoError(t, json.Unmarshal(data, tc))
+	return tc
+}
+
+func checkGolden(t *testing.T, path string, actual []byte) {
+	if *update {
+		require.NoError(t, os.WriteFile(path, actual, 0644))
+		return
+	}
+	expected, err := os.ReadFile(path)
+	require.NoError(t, err, "missing golden file, run the test with -update to create it")
+	assert.Equal(t, string(expected), string(actual))
+}
+
+// TestInjectFilterGolden renders each query of testdata/cases with the SAC
+// filter of its scope, injected as the case requests, and compares the
+// statement and the bind values with the files of the same name in
+// testdata/golden.
+func TestInjectFilterGolden(t *testing.T) {
+	casePaths, err := filepath.Glob(filepath.Join("testdata", "cases", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, casePaths)
+	for _, casePath := range casePaths {
+		name := strings.TrimSuffix(filepath.Base(casePath), ".json")
+		t.Run(name, func(it *testing.T) {
+			tc := loadCase(it, casePath)
+			originalStatement, originalBindValues := tc.Query.ForExecution()
+
+			inject, found := injections[tc.Injection]
+			require.True(it, found, "unknown injection %q", tc.Injection)
+			stmt, bindValues := inject(tc.Query, tc.Scope).ForExecution()
+			encodedBindValues, err := json.MarshalIndent(bindValues, "", "  ")
+			require.NoError(it, err)
+			checkGolden(it, filepath.Join("testdata", "golden", name+".sql"), []byte(stmt+"\n"))
+			checkGolden(it, filepath.Join("testdata", "golden", name+".binds.json"), append(encodedBindValues, '\n'))
+
+			statementAfter, bindValuesAfter := tc.Query.ForExecution()
+			assert.Equal(it, originalStatement, statementAfter, "the request must not be modified")
+			assert.Equal(it, originalBindValues, bindValuesAfter, "the request must not be modified")
+		})
+	}
+}
+
+func TestInjectFilterNil(t *testing.T) {
+	assert.Nil(t, InjectFilter(nil, []scope.ScopeNamespace{{ClusterID: "cluster-1", NamespaceName: "default"}}))
+	assert.Nil(t, InjectExists(nil, []scope.ScopeNamespace{{ClusterID: "cluster-1", NamespaceName: "default"}}))
+}
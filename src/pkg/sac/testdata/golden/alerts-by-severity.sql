@@ -0,0 +1 @@
+select policy_severity, count(*) from alerts where ( ( ( alerts.ClusterId = $1 and ( alerts.Namespace = $2 ) ) or ( alerts.ClusterId = $3 and ( alerts.Namespace = $4 ) ) ) and ( ( alerts.State = $5 or alerts.State = $6 ) ) ) group by alerts.Policy_Severity
@@ -0,0 +1 @@
+select count(*) from alerts where ( ( alerts.ClusterId, alerts.Namespace ) in ( select c::uuid, n::character varying from unnest($1::text[], $2::text[]) as u(c, n) ) and alerts.State = $3::integer )
@@ -0,0 +1 @@
+select count(*) from alerts where ( ( alerts.ClusterId = $1 or alerts.ClusterId = $2 ) and alerts.Policy_Severity = $3 )
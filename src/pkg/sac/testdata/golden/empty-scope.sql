@@ -0,0 +1 @@
+select count(*) from alerts where alerts.Policy_Name = $1
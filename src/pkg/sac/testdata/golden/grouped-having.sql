@@ -0,0 +1 @@
+select alerts.Deployment_Id, count(*) from alerts where ( ( ( alerts.ClusterId = $1 and ( alerts.Namespace = $2 ) ) ) and alerts.State = $3 ) group by alerts.Deployment_Id having count(*) > $4 order by alerts.Deployment_Id limit 10 offset 10
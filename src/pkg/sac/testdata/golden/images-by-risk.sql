@@ -0,0 +1 @@
+select distinct(images.Id) as Image_Sha, images.RiskScore as image_risk_score from images inner join deployments_containers on images.Id = deployments_containers.Image_Id inner join deployments on deployments_containers.deployments_Id = deployments.Id where ( ( deployments.ClusterId = $1 and ( deployments.Namespace = $2 or deployments.Namespace = $3 ) ) or ( deployments.ClusterId = $4 and ( deployments.Namespace = $5 ) ) ) order by images.RiskScore desc limit 6
@@ -0,0 +1 @@
+select deployments.Id from deployments where ( ( deployments.ClusterId = $1 and ( deployments.Namespace = $2 or deployments.Namespace = $3 ) ) or ( deployments.ClusterId = $4 and ( deployments.Namespace = $5 or deployments.Namespace = $6 ) ) or ( deployments.ClusterId = $7 and ( deployments.Namespace = $8 ) ) ) limit 50 offset 100
@@ -0,0 +1 @@
+select "order"."user" as "Order Owner", count(*) from "order" where ( ( ( "order"."Cluster Id" = $1 and ( "order".Namespace = $2 ) ) ) and "order"."state"" or 1=1 --" = $3 ) group by "order"."user"
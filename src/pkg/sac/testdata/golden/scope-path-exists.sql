@@ -0,0 +1 @@
+select count(*) from images where ( exists ( select 1 from deployments_containers inner join deployments on deployments_containers.deployments_Id = deployments.Id where images.Id = deployments_containers.Image_Id and ( ( deployments.ClusterId = $1 and ( deployments.Namespace = $2 ) ) or ( deployments.ClusterId = $3 and ( deployments.Namespace = $4 ) ) ) ) and images.RiskScore = $5 )
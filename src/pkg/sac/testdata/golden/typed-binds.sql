@@ -0,0 +1 @@
+select count(*) from alerts where ( ( ( alerts.ClusterId = $1::uuid and ( alerts.Namespace = $2::character varying or alerts.Namespace = $3::character varying ) ) ) and alerts.State = $4::integer )
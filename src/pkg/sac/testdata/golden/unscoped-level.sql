@@ -0,0 +1 @@
+select count(*) from policies
@@ -6,8 +6,8 @@ import (
 )
 
 type ScopeNamespace struct {
-	ClusterID     string
-	NamespaceName string
+	ClusterID     string `json:"clusterId"`
+	NamespaceName string `json:"namespace"`
 }
 
 func sortNamespaces(namespacesByCluster map[string][]string) ([]string, map[string][]string) {
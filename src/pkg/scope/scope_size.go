@@ -0,0 +1,135 @@
+package scope
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type sizeKind int
+
+const (
+	sizeCount sizeKind = iota
+	sizePercent
+	sizeAll
+	sizeSweep
+)
+
+// defaultSweepStart is the first size of a logarithmic sweep without start.
+const defaultSweepStart = 10
+
+// Size is a scope size expressed as a count of namespaces, a percentage of
+// the namespaces, all of them, or a logarithmic sweep of counts, resolved
+// once the number of namespaces is known.
+type Size struct {
+	kind  sizeKind
+	value float64
+}
+
+// ParseSize parses a size: a count (200), a percentage (50%), all, or a
+// logarithmic sweep (log, or log:20 to start at 20).
+func ParseSize(spec string) (Size, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "all":
+		return Size{kind: sizeAll}, nil
+	case spec == "log":
+		return Size{kind: sizeSweep, value: defaultSweepStart}, nil
+	case strings.HasPrefix(spec, "log:"):
+		start, err := strconv.Atoi(strings.TrimPrefix(spec, "log:"))
+		if err != nil || start <= 0 {
+			return Size{}, errors.Errorf("Invalid sweep start in %q", spec)
+		}
+		return Size{kind: sizeSweep, value: float64(start)}, nil
+	case strings.HasSuffix(spec, "%"):
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(spec, "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return Size{}, errors.Errorf("Invalid percentage %q", spec)
+		}
+		return Size{kind: sizePercent, value: percent}, nil
+	default:
+		count, err := strconv.Atoi(spec)
+		if err != nil || count <= 0 {
+			return Size{}, errors.Errorf("Invalid scope size %q", spec)
+		}
+		return Size{kind: sizeCount, value: float64(count)}, nil
+	}
+}
+
+// ParseSizes parses a comma separated list of sizes.
+func ParseSizes(spec string) ([]Size, error) {
+	sizes := make([]Size, 0)
+	for _, item := range strings.Split(spec, ",") {
+		size, err := ParseSize(item)
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+func (s Size) String() string {
+	switch s.kind {
+	case sizePercent:
+		return strconv.FormatFloat(s.value, 'f', -1, 64) + "%"
+	case sizeAll:
+		return "all"
+	case sizeSweep:
+		return fmt.Sprintf("log:%d", int(s.value))
+	default:
+		return strconv.Itoa(int(s.value))
+	}
+}
+
+// resolve returns the counts of namespaces of the size, out of total.
+// Percentages are rounded up, for small ones not to resolve to no namespace.
+func (s Size) resolve(total int) []int {
+	switch s.kind {
+	case sizePercent:
+		return []int{int(math.Ceil(float64(total) * s.value / 100))}
+	case sizeAll:
+		return []int{total}
+	case sizeSweep:
+		return LogSweep(int(s.value), total)
+	default:
+		return []int{int(s.value)}
+	}
+}
+
+// ResolveSizes returns the increasing counts of namespaces of the sizes, out
+// of total. The counts beyond the total are capped to it, and the repeated
+// ones dropped: the selections taking the first namespaces of their order,
+// the same count always selects the same scope.
+func ResolveSizes(sizes []Size, total int) []int {
+	counts := make([]int, 0, len(sizes))
+	for _, size := range sizes {
+		for _, count := range size.resolve(total) {
+			count = min(count, total)
+			if count > 0 {
+				counts = append(counts, count)
+			}
+		}
+	}
+	slices.Sort(counts)
+	return slices.Compact(counts)
+}
+
+// LogSweep returns the counts of the 1-2-5 sequence, e.g. 10, 20, 50, 100,
+// from the first one not below from, up to to.
+func LogSweep(from, to int) []int {
+	counts := make([]int, 0)
+	for decade := 1; decade <= to; decade *= 10 {
+		for _, step := range []int{1, 2, 5} {
+			count := step * decade
+			if count >= from && count <= to {
+				counts = append(counts, count)
+			}
+		}
+	}
+	return counts
+}
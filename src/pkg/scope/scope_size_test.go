@@ -0,0 +1,44 @@
+package scope
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSizes(t *testing.T) {
+	sizes, err := ParseSizes("200, 50%, 12.5%, all, log, log:20")
+	require.NoError(t, err)
+	names := make([]string, 0, len(sizes))
+	for _, size := range sizes {
+		names = append(names, size.String())
+	}
+	assert.Equal(t, []string{"200", "50%", "12.5%", "all", "log:10", "log:20"}, names)
+
+	for _, spec := range []string{"", "0", "-5", "ten", "0%", "150%", "log:", "log:0", "10,,20"} {
+		_, err := ParseSizes(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestResolveSizes(t *testing.T) {
+	for name, tc := range map[string]struct {
+		spec     string
+		total    int
+		expected []int
+	}{
+		"counts":            {spec: "20,10", total: 100, expected: []int{10, 20}},
+		"percent":           {spec: "50%,1%", total: 5000, expected: []int{50, 2500}},
+		"percent rounds up": {spec: "1%", total: 30, expected: []int{1}},
+		"all":               {spec: "all", total: 37, expected: []int{37}},
+		"capped":            {spec: "10,20,50,100,all", total: 30, expected: []int{10, 20, 30}},
+		"sweep":             {spec: "log,50%,all", total: 5000, expected: []int{10, 20, 50, 100, 200, 500, 1000, 2000, 2500, 5000}},
+		"sweep start":       {spec: "log:3", total: 60, expected: []int{5, 10, 20, 50}},
+		"no namespace":      {spec: "10,all", total: 0, expected: []int{}},
+	} {
+		sizes, err := ParseSizes(tc.spec)
+		require.NoError(t, err, name)
+		assert.Equal(t, tc.expected, ResolveSizes(sizes, tc.total), name)
+	}
+}
@@ -0,0 +1,102 @@
+package scope
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+)
+
+// Distribution summarizes a list of counts.
+type Distribution struct {
+	Min    int     `json:"min"`
+	Median int     `json:"median"`
+	Max    int     `json:"max"`
+	Mean   float64 `json:"mean"`
+}
+
+// Stats describes the shape of a scope: the clusters it touches and the
+// rows of a scope table it covers.
+type Stats struct {
+	Namespaces           int          `json:"namespaces"`
+	Clusters             int          `json:"clusters"`
+	NamespacesPerCluster Distribution `json:"namespacesPerCluster"`
+	// Table is the scope table the rows are counted in, empty when they
+	// were not counted.
+	Table       string  `json:"table,omitempty"`
+	RowsCovered int64   `json:"rowsCovered"`
+	TotalRows   int64   `json:"totalRows"`
+	RowFraction float64 `json:"rowFraction"`
+}
+
+// ComputeStats returns the statistics of the scope that do not depend on
+// the data.
+func ComputeStats(namespaces []ScopeNamespace) *Stats {
+	countByCluster := make(map[string]int)
+	for _, ns := range namespaces {
+		countByCluster[ns.ClusterID]++
+	}
+	counts := make([]int, 0, len(countByCluster))
+	for _, count := range countByCluster {
+		counts = append(counts, count)
+	}
+	return &Stats{
+		Namespaces:           len(namespaces),
+		Clusters:             len(counts),
+		NamespacesPerCluster: distribution(counts),
+	}
+}
+
+func distribution(counts []int) Distribution {
+	if len(counts) == 0 {
+		return Distribution{}
+	}
+	slices.Sort(counts)
+	sum := 0
+	for _, count := range counts {
+		sum += count
+	}
+	return Distribution{
+		Min:    counts[0],
+		Median: counts[len(counts)/2],
+		Max:    counts[len(counts)-1],
+		Mean:   float64(sum) / float64(len(counts)),
+	}
+}
+
+// CountRows fills the statistics with the number of rows of the scope table
+// in the scope, out of all its rows. The namespace column is ignored when
+// empty, for cluster scopes. The columns are compared as text, whatever
+// their types.
+func (s *Stats) CountRows(ctx context.Context, database db.DB, table, clusterColumn, namespaceColumn string, namespaces []ScopeNamespace) error {
+	clusterIDs := make([]string, 0, len(namespaces))
+	namespaceNames := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		clusterIDs = append(clusterIDs, ns.ClusterID)
+		namespaceNames = append(namespaceNames, ns.NamespaceName)
+	}
+	condition := fmt.Sprintf("%s::text = any($1::text[])", query.QuoteIdentifier(clusterColumn))
+	bindValues := []interface{}{clusterIDs}
+	if namespaceColumn != "" {
+		condition = fmt.Sprintf(
+			"(%s::text, %s::text) in (select * from unnest($1::text[], $2::text[]))",
+			query.QuoteIdentifier(clusterColumn),
+			query.QuoteIdentifier(namespaceColumn),
+		)
+		bindValues = append(bindValues, namespaceNames)
+	}
+	stmt := fmt.Sprintf("select count(*) filter (where %s), count(*) from %s", condition, query.QuoteIdentifier(table))
+	err := database.QueryRow(ctx, stmt, bindValues...).Scan(&s.RowsCovered, &s.TotalRows)
+	if err != nil {
+		return errors.Wrapf(err, "Could not count the rows of %s in the scope", table)
+	}
+	s.Table = table
+	s.RowFraction = 0
+	if s.TotalRows > 0 {
+		s.RowFraction = float64(s.RowsCovered) / float64(s.TotalRows)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package scope
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeStats(t *testing.T) {
+	stats := ComputeStats([]ScopeNamespace{
+		{ClusterID: "cluster-1", NamespaceName: "a"},
+		{ClusterID: "cluster-1", NamespaceName: "b"},
+		{ClusterID: "cluster-1", NamespaceName: "c"},
+		{ClusterID: "cluster-2", NamespaceName: "a"},
+		{ClusterID: "cluster-3", NamespaceName: "a"},
+		{ClusterID: "cluster-3", NamespaceName: "b"},
+	})
+	assert.Equal(t, &Stats{
+		Namespaces:           6,
+		Clusters:             3,
+		NamespacesPerCluster: Distribution{Min: 1, Median: 2, Max: 3, Mean: 2},
+	}, stats)
+	assert.Equal(t, &Stats{}, ComputeStats(nil))
+}
+
+func TestCountRows(t *testing.T) {
+	fake := dbtest.New().On("count(*) filter", dbtest.Result{Rows: [][]any{{int64(25), int64(100)}}})
+	namespaces := []ScopeNamespace{{ClusterID: "cluster-1", NamespaceName: "default"}}
+
+	stats := ComputeStats(namespaces)
+	require.NoError(t, stats.CountRows(context.Background(), fake, "deployments", "ClusterId", "Namespace", namespaces))
+	assert.Equal(t, "deployments", stats.Table)
+	assert.Equal(t, int64(25), stats.RowsCovered)
+	assert.Equal(t, int64(100), stats.TotalRows)
+	assert.Equal(t, 0.25, stats.RowFraction)
+
+	require.NoError(t, stats.CountRows(context.Background(), fake, "order", "ClusterId", "", namespaces))
+	calls := fake.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(
+		t,
+		"select count(*) filter (where (ClusterId::text, Namespace::text) in (select * from unnest($1::text[], $2::text[]))), count(*) from deployments",
+		calls[0].SQL,
+	)
+	assert.Equal(t, []any{[]string{"cluster-1"}, []string{"default"}}, calls[0].Args)
+	assert.Equal(t, `select count(*) filter (where ClusterId::text = any($1::text[])), count(*) from "order"`, calls[1].SQL)
+	assert.Equal(t, []any{[]string{"cluster-1"}}, calls[1].Args)
+}
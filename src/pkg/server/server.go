@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/htmlreport"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/metrics"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/report"
+)
+
+const idleCheckInterval = time.Second
+
+// Server exposes the progress and the results of a run over HTTP.
+type Server struct {
+	results     *report.Report
+	metrics     *metrics.Registry
+	httpServer  *http.Server
+	listener    net.Listener
+	idleTimeout time.Duration
+
+	lock        sync.Mutex
+	lastRequest time.Time
+
+	shutdownOnce sync.Once
+	shutdown     chan struct{}
+}
+
+func Start(addr string, results *report.Report, registry *metrics.Registry, idleTimeout time.Duration) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not listen on %q", addr)
+	}
+	s := &Server{
+		results:     results,
+		metrics:     registry,
+		listener:    listener,
+		idleTimeout: idleTimeout,
+		lastRequest: time.Now(),
+		shutdown:    make(chan struct{}),
+	}
+	s.httpServer = &http.Server{Handler: s.touch(s.routes())}
+	go func() {
+		err := s.httpServer.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("Error serving HTTP: %v\n", err)
+		}
+	}()
+	return s, nil
+}
+
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *Server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+	mux.HandleFunc("GET /progress", s.handleProgress)
+	mux.HandleFunc("GET /results.json", s.handleJSON)
+	mux.HandleFunc("GET /results.csv", s.handleCSV)
+	mux.HandleFunc("GET /report.html", s.handleHTML)
+	mux.HandleFunc("GET /plans/{index}", s.handlePlan)
+	mux.HandleFunc("POST /shutdown", s.handleShutdown)
+	if s.metrics != nil {
+		mux.Handle("GET /metrics", s.metrics)
+	}
+	return mux
+}
+
+func (s *Server) touch(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.lastRequest = time.Now()
+		s.lock.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Wait blocks until a shutdown is requested, the context is done, or no
+// request was received for the idle timeout, then stops the server.
+// A zero idle timeout disables the idle shutdown.
+func (s *Server) Wait(ctx context.Context) error {
+	s.lock.Lock()
+	s.lastRequest = time.Now()
+	s.lock.Unlock()
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+	for waiting := true; waiting; {
+		select {
+		case <-ctx.Done():
+			waiting = false
+		case <-s.shutdown:
+			waiting = false
+		case <-ticker.C:
+			s.lock.Lock()
+			idle := time.Since(s.lastRequest)
+			s.lock.Unlock()
+			if s.idleTimeout > 0 && idle >= s.idleTimeout {
+				fmt.Printf("No request received for %s, shutting down\n", idle.Round(time.Second))
+				waiting = false
+			}
+		}
+	}
+	return s.Close()
+}
+
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.httpServer.Shutdown(ctx)
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, _ *http.Request) {
+	snapshot := s.results.Snapshot()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := indexTemplate.Execute(w, struct {
+		Report   *report.Report
+		Progress report.Progress
+		Metrics  bool
+	}{Report: snapshot, Progress: s.results.Progress(), Metrics: s.metrics != nil})
+	if err != nil {
+		fmt.Printf("Error rendering index page: %v\n", err)
+	}
+}
+
+func (s *Server) handleProgress(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.results.Progress()); err != nil {
+		fmt.Printf("Error writing progress: %v\n", err)
+	}
+}
+
+func (s *Server) handleJSON(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="results.json"`)
+	if err := s.results.WriteJSON(w); err != nil {
+		fmt.Printf("Error writing JSON results: %v\n", err)
+	}
+}
+
+func (s *Server) handleCSV(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="results.csv"`)
+	if err := s.results.WriteCSV(w); err != nil {
+		fmt.Printf("Error writing CSV results: %v\n", err)
+	}
+}
+
+func (s *Server) handleHTML(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := htmlreport.Render(w, s.results.Snapshot()); err != nil {
+		fmt.Printf("Error writing HTML report: %v\n", err)
+	}
+}
+
+func (s *Server) handlePlan(w http.ResponseWriter, r *http.Request) {
+	snapshot := s.results.Snapshot()
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 || index >= len(snapshot.Entries) {
+		http.NotFound(w, r)
+		return
+	}
+	entry := snapshot.Entries[index]
+	if entry.Plan == nil {
+		http.Error(w, "no plan recorded for this entry", http.StatusNotFound)
+		return
+	}
+	data, err := json.Marshal(entry.Plan)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(data); err != nil {
+		fmt.Printf("Error writing plan: %v\n", err)
+	}
+}
+
+func (s *Server) handleShutdown(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = fmt.Fprintln(w, "shutting down")
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>SAC SQL performance - {{.Report.Database}}</title>
+{{if not .Progress.Done}}<meta http-equiv="refresh" content="10">{{end}}
+</head>
+<body>
+<h1>SAC SQL performance</h1>
+<p>Database {{.Report.Database}}, run started at {{.Report.StartedAt.Format "2006-01-02 15:04:05 MST"}}.</p>
+<p>{{if .Progress.Done}}Run complete{{else}}Run in progress{{end}}: {{.Progress.Completed}} of {{.Progress.Planned}} entries.</p>
+<ul>
+<li><a href="report.html">HTML report</a></li>
+<li><a href="results.json">JSON results</a></li>
+<li><a href="results.csv">CSV results</a></li>
+<li><a href="progress">Progress</a></li>
+{{if .Metrics}}<li><a href="metrics">Prometheus metrics</a></li>{{end}}
+</ul>
+<form method="post" action="shutdown"><button type="submit">Shut down</button></form>
+<h2>Plans</h2>
+<ul>
+{{range $ix, $entry := .Report.Entries}}<li>{{if $entry.Plan}}<a href="plans/{{$ix}}">{{end}}{{$entry.Query}}, {{$entry.Selection}} / {{$entry.Injection}}{{if $entry.Rendering}} / {{$entry.Rendering}}{{end}}, {{$entry.ScopeSize}} namespaces{{if $entry.Plan}}</a>{{end}}{{if $entry.Error}}: {{$entry.Error}}{{end}}</li>
+{{end}}</ul>
+</body>
+</html>
+`))
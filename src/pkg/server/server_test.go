@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/explain"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/metrics"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, url string) (int, string) {
+	response, err := http.Get(url)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	return response.StatusCode, string(body)
+}
+
+func TestServer(t *testing.T) {
+	results := report.New("central_active")
+	results.SetPlanned(2)
+	results.Add(&report.Entry{
+		Query:     "query-0",
+		Selection: report.SelectionNone,
+		Injection: report.InjectionNone,
+		Plan:      &explain.Plan{Plan: explain.Node{NodeType: "Seq Scan"}},
+	})
+	results.Add(&report.Entry{
+		Query:     "query-0",
+		Selection: report.SelectionOrdered,
+		Injection: report.InjectionOrTree,
+		Rendering: report.RenderingLiterals,
+		ScopeSize: 10,
+	})
+	registry := metrics.NewRegistry()
+	registry.Observe(results.Entries[0])
+	s, err := Start("127.0.0.1:0", results, registry, 0)
+	require.NoError(t, err)
+	base := "http://" + s.Addr()
+
+	status, body := get(t, base+"/progress")
+	assert.Equal(t, http.StatusOK, status)
+	progress := report.Progress{}
+	require.NoError(t, json.Unmarshal([]byte(body), &progress))
+	assert.Equal(t, report.Progress{Planned: 2, Completed: 2}, progress)
+
+	status, body = get(t, base+"/")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "Run in progress: 2 of 2 entries.")
+	assert.Contains(t, body, "query-0, ordered / or-tree / literals, 10 namespaces")
+
+	status, body = get(t, base+"/results.csv")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, strings.Split(strings.TrimSpace(body), "\n"), 3)
+
+	status, body = get(t, base+"/results.json")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"database": "central_active"`)
+
+	status, body = get(t, base+"/plans/0")
+	assert.Equal(t, http.StatusOK, status)
+	plan, err := explain.Parse([]byte(body))
+	require.NoError(t, err)
+	assert.Equal(t, "Seq Scan", plan.Plan.NodeType)
+
+	status, _ = get(t, base+"/plans/1")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, body = get(t, base+"/metrics")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `sacsqlperf_entries_total{query="query-0",scope_size="0",selection="none",injection="none",rendering=""} 1`)
+
+	status, body = get(t, base+"/report.html")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "<h2>query-0</h2>")
+
+	waitResult := make(chan error)
+	go func() { waitResult <- s.Wait(context.Background()) }()
+	response, err := http.Post(base+"/shutdown", "text/plain", nil)
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	select {
+	case err = <-waitResult:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	s, err := Start("127.0.0.1:0", report.New("central_active"), nil, time.Millisecond)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, s.Wait(ctx))
+	assert.NoError(t, ctx.Err())
+}
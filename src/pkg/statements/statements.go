@@ -0,0 +1,150 @@
+package statements
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/explain"
+)
+
+// The snapshots only cover the statements explained by the tool: the
+// statements of the other sessions of the database, and the auxiliary ones
+// of the tool, such as the cache preparation or the result set checksums,
+// are left out of the deltas. The statements explained by the tool are the
+// top-level ones, the profiled statements are only nested in them.
+const snapshotStatement = `select userid, queryid, toplevel, calls,
+total_exec_time, total_plan_time, rows,
+shared_blks_hit, shared_blks_read, local_blks_hit, local_blks_read,
+temp_blks_read, temp_blks_written,
+wal_records, wal_fpi, wal_bytes::float8
+from pg_stat_statements
+where dbid = (select oid from pg_database where datname = current_database())
+and queryid is not null
+and toplevel
+and starts_with(query, $1)`
+
+type Counters struct {
+	Calls           int64   `json:"calls"`
+	TotalExecTime   float64 `json:"totalExecTime"`
+	MeanExecTime    float64 `json:"meanExecTime"`
+	TotalPlanTime   float64 `json:"totalPlanTime"`
+	Rows            int64   `json:"rows"`
+	SharedBlksHit   int64   `json:"sharedBlksHit"`
+	SharedBlksRead  int64   `json:"sharedBlksRead"`
+	LocalBlksHit    int64   `json:"localBlksHit"`
+	LocalBlksRead   int64   `json:"localBlksRead"`
+	TempBlksRead    int64   `json:"tempBlksRead"`
+	TempBlksWritten int64   `json:"tempBlksWritten"`
+	WalRecords      int64   `json:"walRecords"`
+	WalFpi          int64   `json:"walFpi"`
+	WalBytes        float64 `json:"walBytes"`
+}
+
+func (c *Counters) add(other Counters) {
+	c.Calls += other.Calls
+	c.TotalExecTime += other.TotalExecTime
+	c.TotalPlanTime += other.TotalPlanTime
+	c.Rows += other.Rows
+	c.SharedBlksHit += other.SharedBlksHit
+	c.SharedBlksRead += other.SharedBlksRead
+	c.LocalBlksHit += other.LocalBlksHit
+	c.LocalBlksRead += other.LocalBlksRead
+	c.TempBlksRead += other.TempBlksRead
+	c.TempBlksWritten += other.TempBlksWritten
+	c.WalRecords += other.WalRecords
+	c.WalFpi += other.WalFpi
+	c.WalBytes += other.WalBytes
+}
+
+func (c *Counters) subtract(other Counters) {
+	c.Calls -= other.Calls
+	c.TotalExecTime -= other.TotalExecTime
+	c.TotalPlanTime -= other.TotalPlanTime
+	c.Rows -= other.Rows
+	c.SharedBlksHit -= other.SharedBlksHit
+	c.SharedBlksRead -= other.SharedBlksRead
+	c.LocalBlksHit -= other.LocalBlksHit
+	c.LocalBlksRead -= other.LocalBlksRead
+	c.TempBlksRead -= other.TempBlksRead
+	c.TempBlksWritten -= other.TempBlksWritten
+	c.WalRecords -= other.WalRecords
+	c.WalFpi -= other.WalFpi
+	c.WalBytes -= other.WalBytes
+}
+
+type key struct {
+	userID   uint32
+	queryID  int64
+	topLevel bool
+}
+
+type Snapshot map[key]Counters
+
+type Delta struct {
+	Counters
+	// Statements is the number of distinct statements executed between
+	// the two snapshots.
+	Statements int `json:"statements"`
+}
+
+// Take reads the counters of the statements explained by the tool.
+func Take(ctx context.Context, db db.DB) (Snapshot, error) {
+	rows, err := db.Query(ctx, snapshotStatement, explain.Statement(""))
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not query pg_stat_statements")
+	}
+	defer rows.Close()
+	snapshot := make(Snapshot)
+	for rows.Next() {
+		var k key
+		var c Counters
+		err = rows.Scan(
+			&k.userID,
+			&k.queryID,
+			&k.topLevel,
+			&c.Calls,
+			&c.TotalExecTime,
+			&c.TotalPlanTime,
+			&c.Rows,
+			&c.SharedBlksHit,
+			&c.SharedBlksRead,
+			&c.LocalBlksHit,
+			&c.LocalBlksRead,
+			&c.TempBlksRead,
+			&c.TempBlksWritten,
+			&c.WalRecords,
+			&c.WalFpi,
+			&c.WalBytes,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not read pg_stat_statements")
+		}
+		snapshot[k] = c
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Could not read pg_stat_statements")
+	}
+	return snapshot, nil
+}
+
+// Delta aggregates the counter increments of the statements that were
+// executed between the receiver snapshot and the later one.
+func (s Snapshot) Delta(later Snapshot) *Delta {
+	delta := &Delta{}
+	for k, laterCounters := range later {
+		counters := laterCounters
+		if earlierCounters, found := s[k]; found {
+			counters.subtract(earlierCounters)
+		}
+		if counters.Calls <= 0 {
+			continue
+		}
+		delta.Statements++
+		delta.add(counters)
+	}
+	if delta.Calls > 0 {
+		delta.MeanExecTime = delta.TotalExecTime / float64(delta.Calls)
+	}
+	return delta
+}
@@ -0,0 +1,75 @@
+package statements
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db/dbtest"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/explain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelta(t *testing.T) {
+	unchanged := key{userID: 10, queryID: 1, topLevel: true}
+	updated := key{userID: 10, queryID: 2, topLevel: true}
+	added := key{userID: 10, queryID: 3, topLevel: true}
+
+	before := Snapshot{
+		unchanged: {Calls: 4, TotalExecTime: 8, Rows: 40, SharedBlksHit: 100},
+		updated:   {Calls: 1, TotalExecTime: 2, Rows: 10, SharedBlksHit: 20, SharedBlksRead: 5},
+	}
+	after := Snapshot{
+		unchanged: {Calls: 4, TotalExecTime: 8, Rows: 40, SharedBlksHit: 100},
+		updated:   {Calls: 3, TotalExecTime: 8, Rows: 30, SharedBlksHit: 50, SharedBlksRead: 6, WalBytes: 12},
+		added:     {Calls: 1, TotalExecTime: 3, Rows: 1, TempBlksWritten: 7},
+	}
+
+	delta := before.Delta(after)
+	assert.Equal(t, &Delta{
+		Counters: Counters{
+			Calls:           3,
+			TotalExecTime:   9,
+			MeanExecTime:    3,
+			Rows:            21,
+			SharedBlksHit:   30,
+			SharedBlksRead:  1,
+			TempBlksWritten: 7,
+			WalBytes:        12,
+		},
+		Statements: 2,
+	}, delta)
+}
+
+func TestDeltaNoActivity(t *testing.T) {
+	snapshot := Snapshot{
+		key{userID: 10, queryID: 1}: {Calls: 4, TotalExecTime: 8},
+	}
+	assert.Equal(t, &Delta{}, snapshot.Delta(snapshot))
+}
+
+func TestTake(t *testing.T) {
+	fake := dbtest.New().On("pg_stat_statements", dbtest.Result{Rows: [][]any{
+		{uint32(10), int64(1), true, int64(3), 9.0, 1.5, int64(30), int64(50), int64(6), int64(0), int64(0), int64(0), int64(7), int64(0), int64(0), 12.0},
+	}})
+	snapshot, err := Take(context.Background(), fake)
+	require.NoError(t, err)
+	assert.Equal(t, Snapshot{
+		key{userID: 10, queryID: 1, topLevel: true}: {
+			Calls:           3,
+			TotalExecTime:   9,
+			TotalPlanTime:   1.5,
+			Rows:            30,
+			SharedBlksHit:   50,
+			SharedBlksRead:  6,
+			TempBlksWritten: 7,
+			WalBytes:        12,
+		},
+	}, snapshot)
+
+	// Only the statements explained by the tool are read.
+	calls := fake.Calls()
+	require.Len(t, calls, 1)
+	assert.Contains(t, calls[0].SQL, "starts_with(query, $1)")
+	assert.Equal(t, []any{explain.Statement("")}, calls[0].Args)
+}
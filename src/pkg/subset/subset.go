@@ -0,0 +1,406 @@
+package subset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+)
+
+const (
+	ManifestFile = "manifest.json"
+
+	clusterListStatement = "select id::text from clusters %s order by name limit $1"
+	tableExistsStatement = "select to_regclass($1) is not null"
+	columnsStatement     = `select attname, format_type(atttypid, atttypmod)
+from pg_attribute
+where attrelid = $1::regclass and attnum > 0 and not attisdropped
+order by attnum`
+	indexesStatement = "select indexdef from pg_indexes where schemaname = current_schema() and tablename = $1 order by indexname"
+)
+
+// indexDefinition matches the index definitions of pg_indexes, capturing
+// the name of the indexed table and what follows its access method.
+var indexDefinition = regexp.MustCompile(
+	`^CREATE (?:UNIQUE )?INDEX (?:[a-z_][a-z0-9_$]*|"[^"]+") ON (?:ONLY )?(?:[a-z_][a-z0-9_]*\.)?([a-z_][a-z0-9_$]*|"[^"]+") USING [a-z]+ (\(.*)$`,
+)
+
+// tableSpec tells how the rows of a table relate to the dumped clusters.
+// The filter is a condition on the table rows, in which %s stands for the
+// array literal of the cluster IDs.
+type tableSpec struct {
+	name   string
+	filter string
+}
+
+// Parent tables come first so that the files can be loaded in order.
+var tableSpecs = []tableSpec{
+	{name: "clusters", filter: "id = any(%s)"},
+	{name: "namespaces", filter: "clusterid = any(%s)"},
+	{name: "deployments", filter: "clusterid = any(%s)"},
+	{
+		name: "images",
+		filter: `id in (select deployments_containers.image_id from deployments_containers
+inner join deployments on deployments_containers.deployments_id = deployments.id
+where deployments.clusterid = any(%s))`,
+	},
+	{name: "deployments_containers", filter: "deployments_id in (select id from deployments where clusterid = any(%s))"},
+	{name: "alerts", filter: "clusterid = any(%s)"},
+}
+
+// Selection chooses the dumped clusters: the named ones, or the first
+// ones by name.
+type Selection struct {
+	Clusters     int
+	ClusterNames []string
+}
+
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type Table struct {
+	Name    string   `json:"name"`
+	File    string   `json:"file"`
+	Columns []Column `json:"columns"`
+	Indexes []string `json:"indexes"`
+	Rows    int64    `json:"rows"`
+}
+
+// Manifest describes the files of a dump.
+type Manifest struct {
+	Database  string    `json:"database"`
+	CreatedAt time.Time `json:"createdAt"`
+	Clusters  []string  `json:"clusters"`
+	Tables    []*Table  `json:"tables"`
+}
+
+// Dump writes the rows of the selected clusters to one CSV file per table
+// in the directory, with a manifest of the table definitions. The tables are
+// read in a single repeatable read transaction, the subset is consistent.
+func Dump(ctx context.Context, database db.DB, dir string, selection Selection) (*Manifest, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "Could not create directory %q", dir)
+	}
+	tx, err := database.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not begin transaction")
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	_, err = tx.Exec(ctx, "set transaction isolation level repeatable read, read only")
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not set transaction isolation level")
+	}
+
+	manifest := &Manifest{CreatedAt: time.Now().UTC()}
+	if err = tx.QueryRow(ctx, "select current_database()").Scan(&manifest.Database); err != nil {
+		return nil, errors.Wrap(err, "Could not read database name")
+	}
+	manifest.Clusters, err = clusterIDs(ctx, tx, selection)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.Clusters) == 0 {
+		return nil, errors.New("no cluster selected")
+	}
+	clusters := arrayLiteral(manifest.Clusters)
+	for _, spec := range tableSpecs {
+		var exists bool
+		if err = tx.QueryRow(ctx, tableExistsStatement, spec.name).Scan(&exists); err != nil {
+			return nil, errors.Wrapf(err, "Could not look up table %q", spec.name)
+		}
+		if !exists {
+			fmt.Printf("Table %q not found, skipped\n", spec.name)
+			continue
+		}
+		table, err := describeTable(ctx, tx, spec.name)
+		if err != nil {
+			return nil, err
+		}
+		table.Rows, err = dumpTable(ctx, tx, filepath.Join(dir, table.File), spec, clusters)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Dumped %d rows of table %q\n", table.Rows, table.Name)
+		manifest.Tables = append(manifest.Tables, table)
+	}
+	if err = manifest.WriteFile(dir); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Load creates the tables of the dump manifest in the database, dropping
+// the existing ones first when reset is set, copies the files in them and
+// creates their indexes, in a single transaction.
+func Load(ctx context.Context, database db.DB, dir string, reset bool) (*Manifest, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err = manifest.Validate(); err != nil {
+		return nil, err
+	}
+	tx, err := database.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not begin transaction")
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if reset {
+		for i := len(manifest.Tables) - 1; i >= 0; i-- {
+			name := manifest.Tables[i].Name
+			_, err = tx.Exec(ctx, fmt.Sprintf("drop table if exists %s cascade", pgx.Identifier{name}.Sanitize()))
+			if err != nil {
+				return nil, errors.Wrapf(err, "Could not drop table %q", name)
+			}
+		}
+	}
+	for _, table := range manifest.Tables {
+		if _, err = tx.Exec(ctx, createTableStatement(table)); err != nil {
+			return nil, errors.Wrapf(err, "Could not create table %q", table.Name)
+		}
+		rows, err := loadTable(ctx, tx, filepath.Join(dir, table.File), table)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Loaded %d rows in table %q\n", rows, table.Name)
+		for _, index := range table.Indexes {
+			if _, err = tx.Exec(ctx, createIndexStatement(index)); err != nil {
+				return nil, errors.Wrapf(err, "Could not create index of table %q", table.Name)
+			}
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "Could not commit load")
+	}
+	if _, err = database.Exec(ctx, "analyze"); err != nil {
+		return nil, errors.Wrap(err, "Could not analyze tables")
+	}
+	return manifest, nil
+}
+
+// Validate checks the table definitions of the manifest before they are
+// rendered in statements: the tables are the dumped ones, the column types
+// plain type names and the indexes created on their own table.
+func (m *Manifest) Validate() error {
+	for _, table := range m.Tables {
+		if !slices.ContainsFunc(tableSpecs, func(spec tableSpec) bool { return spec.name == table.Name }) {
+			return errors.Errorf("Unexpected table %q in manifest", table.Name)
+		}
+		if table.File != filepath.Base(table.File) {
+			return errors.Errorf("Invalid file %q of table %q in manifest", table.File, table.Name)
+		}
+		if len(table.Columns) == 0 {
+			return errors.Errorf("No column of table %q in manifest", table.Name)
+		}
+		for _, column := range table.Columns {
+			if err := query.ValidateIdentifier(column.Name); err != nil {
+				return errors.Wrapf(err, "Invalid column of table %q in manifest", table.Name)
+			}
+			if err := query.ValidateType(column.Type); err != nil {
+				return errors.Wrapf(err, "Invalid column %q of table %q in manifest", column.Name, table.Name)
+			}
+		}
+		for _, index := range table.Indexes {
+			if err := validateIndex(table.Name, index); err != nil {
+				return errors.Wrapf(err, "Invalid index of table %q in manifest", table.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateIndex accepts the index definitions of pg_indexes on the table,
+// whose key columns and predicate form a single expression.
+func validateIndex(table, indexDef string) error {
+	match := indexDefinition.FindStringSubmatch(indexDef)
+	if match == nil {
+		return errors.Errorf("unsupported index definition %q", indexDef)
+	}
+	if match[1] != table && match[1] != (pgx.Identifier{table}).Sanitize() {
+		return errors.Errorf("index definition %q is not on table %q", indexDef, table)
+	}
+	return query.RawExpression(match[2]).Validate()
+}
+
+func (m *Manifest) WriteFile(dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Could not encode manifest")
+	}
+	path := filepath.Join(dir, ManifestFile)
+	if err = os.WriteFile(path, data, 0644); err != nil {
+		return errors.Wrapf(err, "Could not write %q", path)
+	}
+	return nil
+}
+
+func ReadManifest(dir string) (*Manifest, error) {
+	path := filepath.Join(dir, ManifestFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not read %q", path)
+	}
+	manifest := &Manifest{}
+	if err = json.Unmarshal(data, manifest); err != nil {
+		return nil, errors.Wrapf(err, "Could not decode %q", path)
+	}
+	return manifest, nil
+}
+
+func clusterIDs(ctx context.Context, tx pgx.Tx, selection Selection) ([]string, error) {
+	filter := ""
+	limit := selection.Clusters
+	args := []any{}
+	if len(selection.ClusterNames) > 0 {
+		filter = "where name = any($2)"
+		limit = len(selection.ClusterNames)
+		args = append(args, selection.ClusterNames)
+	}
+	rows, err := tx.Query(ctx, fmt.Sprintf(clusterListStatement, filter), append([]any{limit}, args...)...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not list clusters")
+	}
+	defer rows.Close()
+	ids := make([]string, 0, limit)
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "Could not list clusters")
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Could not list clusters")
+	}
+	if len(selection.ClusterNames) > 0 && len(ids) != len(selection.ClusterNames) {
+		return nil, errors.Errorf("found %d of the %d named clusters", len(ids), len(selection.ClusterNames))
+	}
+	return ids, nil
+}
+
+func describeTable(ctx context.Context, tx pgx.Tx, name string) (*Table, error) {
+	table := &Table{Name: name, File: name + ".csv"}
+	rows, err := tx.Query(ctx, columnsStatement, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not list columns of %q", name)
+	}
+	for rows.Next() {
+		var column Column
+		if err = rows.Scan(&column.Name, &column.Type); err != nil {
+			rows.Close()
+			return nil, errors.Wrapf(err, "Could not list columns of %q", name)
+		}
+		table.Columns = append(table.Columns, column)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "Could not list columns of %q", name)
+	}
+	rows, err = tx.Query(ctx, indexesStatement, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not list indexes of %q", name)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var index string
+		if err = rows.Scan(&index); err != nil {
+			return nil, errors.Wrapf(err, "Could not list indexes of %q", name)
+		}
+		table.Indexes = append(table.Indexes, index)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "Could not list indexes of %q", name)
+	}
+	return table, nil
+}
+
+func dumpTable(ctx context.Context, tx pgx.Tx, path string, spec tableSpec, clusters string) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Could not create %q", path)
+	}
+	defer f.Close()
+	tag, err := tx.Conn().PgConn().CopyTo(ctx, f, dumpStatement(spec, clusters))
+	if err != nil {
+		return 0, errors.Wrapf(err, "Could not dump table %q", spec.name)
+	}
+	if err = f.Close(); err != nil {
+		return 0, errors.Wrapf(err, "Could not write %q", path)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func loadTable(ctx context.Context, tx pgx.Tx, path string, table *Table) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Could not open %q", path)
+	}
+	defer f.Close()
+	tag, err := tx.Conn().PgConn().CopyFrom(ctx, f, loadStatement(table))
+	if err != nil {
+		return 0, errors.Wrapf(err, "Could not load table %q", table.Name)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func dumpStatement(spec tableSpec, clusters string) string {
+	return fmt.Sprintf(
+		"copy (select * from %s where %s) to stdout with (format csv, header)",
+		pgx.Identifier{spec.name}.Sanitize(),
+		fmt.Sprintf(spec.filter, clusters),
+	)
+}
+
+func loadStatement(table *Table) string {
+	columns := make([]string, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		columns = append(columns, pgx.Identifier{column.Name}.Sanitize())
+	}
+	return fmt.Sprintf(
+		"copy %s (%s) from stdin with (format csv, header)",
+		pgx.Identifier{table.Name}.Sanitize(),
+		strings.Join(columns, ", "),
+	)
+}
+
+func createTableStatement(table *Table) string {
+	columns := make([]string, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		columns = append(columns, fmt.Sprintf("%s %s", pgx.Identifier{column.Name}.Sanitize(), column.Type))
+	}
+	return fmt.Sprintf(
+		"create table if not exists %s (%s)",
+		pgx.Identifier{table.Name}.Sanitize(),
+		strings.Join(columns, ", "),
+	)
+}
+
+// createIndexStatement makes the index definitions of pg_indexes
+// idempotent, the indexes of a table created by an earlier load are kept.
+func createIndexStatement(indexDef string) string {
+	for _, prefix := range []string{"CREATE UNIQUE INDEX ", "CREATE INDEX "} {
+		if strings.HasPrefix(indexDef, prefix) {
+			return prefix + "IF NOT EXISTS " + strings.TrimPrefix(indexDef, prefix)
+		}
+	}
+	return indexDef
+}
+
+// arrayLiteral renders the values as a quoted array literal, whose type is
+// resolved from the column it is compared with.
+func arrayLiteral(values []string) string {
+	literal, _ := query.QuoteLiteral(values)
+	return literal
+}
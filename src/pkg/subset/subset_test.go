@@ -0,0 +1,129 @@
+package subset
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db/pgtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatements(t *testing.T) {
+	clusters := arrayLiteral([]string{"c1", `we"ird\'`})
+	assert.Equal(t, `'{"c1","we\"ird\\''"}'`, clusters)
+	assert.Equal(
+		t,
+		`copy (select * from "alerts" where clusterid = any('{"c1"}')) to stdout with (format csv, header)`,
+		dumpStatement(tableSpec{name: "alerts", filter: "clusterid = any(%s)"}, arrayLiteral([]string{"c1"})),
+	)
+
+	table := &Table{
+		Name: "alerts",
+		Columns: []Column{
+			{Name: "id", Type: "uuid"},
+			{Name: "policy_name", Type: "character varying"},
+			{Name: "Time", Type: "timestamp without time zone"},
+		},
+	}
+	assert.Equal(
+		t,
+		`create table if not exists "alerts" ("id" uuid, "policy_name" character varying, "Time" timestamp without time zone)`,
+		createTableStatement(table),
+	)
+	assert.Equal(t, `copy "alerts" ("id", "policy_name", "Time") from stdin with (format csv, header)`, loadStatement(table))
+
+	for indexDef, expected := range map[string]string{
+		"CREATE UNIQUE INDEX alerts_pkey ON public.alerts USING btree (id)":                  "CREATE UNIQUE INDEX IF NOT EXISTS alerts_pkey ON public.alerts USING btree (id)",
+		"CREATE INDEX alerts_sac_filter ON public.alerts USING btree (namespace, clusterid)": "CREATE INDEX IF NOT EXISTS alerts_sac_filter ON public.alerts USING btree (namespace, clusterid)",
+	} {
+		assert.Equal(t, expected, createIndexStatement(indexDef))
+	}
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	manifest := &Manifest{
+		Database: "central_active",
+		Clusters: []string{"c1"},
+		Tables: []*Table{
+			{Name: "clusters", File: "clusters.csv", Columns: []Column{{Name: "id", Type: "uuid"}}, Rows: 1},
+		},
+	}
+	require.NoError(t, manifest.WriteFile(dir))
+	read, err := ReadManifest(dir)
+	require.NoError(t, err)
+	assert.Equal(t, manifest, read)
+}
+
+func TestManifestValidate(t *testing.T) {
+	valid := func() *Manifest {
+		return &Manifest{
+			Tables: []*Table{
+				{
+					Name:    "alerts",
+					File:    "alerts.csv",
+					Columns: []Column{{Name: "id", Type: "uuid"}, {Name: "Time", Type: "timestamp without time zone"}},
+					Indexes: []string{
+						"CREATE UNIQUE INDEX alerts_pkey ON public.alerts USING btree (id)",
+						"CREATE INDEX alerts_recent ON public.alerts USING btree (\"Time\") WHERE (state = 0)",
+					},
+				},
+			},
+		}
+	}
+	assert.NoError(t, valid().Validate())
+
+	for name, modify := range map[string]func(table *Table){
+		"table":         func(table *Table) { table.Name = "pg_authid" },
+		"file":          func(table *Table) { table.File = "../alerts.csv" },
+		"no column":     func(table *Table) { table.Columns = nil },
+		"column type":   func(table *Table) { table.Columns[0].Type = "uuid default gen_random_uuid()" },
+		"injected type": func(table *Table) { table.Columns[0].Type = "uuid); drop table clusters; --" },
+		"other table":   func(table *Table) { table.Indexes = []string{"CREATE INDEX x ON public.clusters USING btree (id)"} },
+		"not an index":  func(table *Table) { table.Indexes = []string{"DROP TABLE clusters"} },
+		"statement": func(table *Table) {
+			table.Indexes = []string{"CREATE INDEX x ON alerts USING btree (id); DROP TABLE clusters"}
+		},
+		"comment":        func(table *Table) { table.Indexes = []string{"CREATE INDEX x ON alerts USING btree (id) -- "} },
+		"no column list": func(table *Table) { table.Indexes = []string{"CREATE INDEX x ON alerts USING btree"} },
+	} {
+		manifest := valid()
+		modify(manifest.Tables[0])
+		assert.Error(t, manifest.Validate(), name)
+	}
+}
+
+func TestDumpLoad(t *testing.T) {
+	server := pgtest.StartCentral(t)
+	source := server.Connect(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	manifest, err := Dump(ctx, source, dir, Selection{Clusters: 2})
+	require.NoError(t, err)
+	assert.Len(t, manifest.Clusters, 2)
+	require.Len(t, manifest.Tables, len(tableSpecs))
+	rowsByTable := make(map[string]int64)
+	for _, table := range manifest.Tables {
+		rowsByTable[table.Name] = table.Rows
+	}
+	assert.Equal(t, int64(2), rowsByTable["clusters"])
+	assert.Equal(t, int64(20), rowsByTable["namespaces"])
+	assert.Equal(t, int64(400), rowsByTable["alerts"])
+
+	target := pgtest.ConnectTo(t, server.NewDatabase(t, "restored"))
+	_, err = Load(ctx, target, dir, false)
+	require.NoError(t, err)
+	for name, rows := range rowsByTable {
+		var count int64
+		require.NoError(t, target.QueryRow(ctx, "select count(*) from "+name).Scan(&count))
+		assert.Equal(t, rows, count, name)
+	}
+	var indexes int
+	require.NoError(t, target.QueryRow(ctx, "select count(*) from pg_indexes where indexname = 'alerts_sac_filter'").Scan(&indexes))
+	assert.Equal(t, 1, indexes)
+
+	_, err = Load(ctx, target, dir, true)
+	require.NoError(t, err)
+}
@@ -0,0 +1,143 @@
+package tablestats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/query"
+)
+
+const (
+	sizeStatement = `select reltuples::bigint,
+pg_relation_size(oid), pg_indexes_size(oid), pg_total_relation_size(oid)
+from pg_class where oid = $1::regclass`
+
+	maintenanceStatement = `select last_vacuum, last_autovacuum, last_analyze, last_autoanalyze
+from pg_stat_user_tables where relid = $1::regclass`
+
+	indexStatement = `select indexrelid::regclass::text, pg_get_indexdef(indexrelid), pg_relation_size(indexrelid)
+from pg_index where indrelid = $1::regclass order by 1`
+
+	columnStatement = `select attname, null_frac, n_distinct, most_common_vals::text::text[], most_common_freqs, correlation
+from pg_stats
+where schemaname = any(current_schemas(false)) and tablename = $1 and attname = any($2)
+order by attname`
+)
+
+type Index struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+	Size       int64  `json:"size"`
+}
+
+type Column struct {
+	Name             string    `json:"name"`
+	NullFraction     float64   `json:"nullFraction"`
+	NDistinct        float64   `json:"nDistinct"`
+	MostCommonValues []string  `json:"mostCommonValues,omitempty"`
+	MostCommonFreqs  []float64 `json:"mostCommonFreqs,omitempty"`
+	Correlation      *float64  `json:"correlation,omitempty"`
+}
+
+type Table struct {
+	Name            string     `json:"name"`
+	RowCount        int64      `json:"rowCount"`
+	RowEstimate     int64      `json:"rowEstimate"`
+	TableSize       int64      `json:"tableSize"`
+	IndexesSize     int64      `json:"indexesSize"`
+	TotalSize       int64      `json:"totalSize"`
+	LastVacuum      *time.Time `json:"lastVacuum,omitempty"`
+	LastAutovacuum  *time.Time `json:"lastAutovacuum,omitempty"`
+	LastAnalyze     *time.Time `json:"lastAnalyze,omitempty"`
+	LastAutoanalyze *time.Time `json:"lastAutoanalyze,omitempty"`
+	Indexes         []Index    `json:"indexes"`
+	Columns         []Column   `json:"columns,omitempty"`
+}
+
+// Capture collects the size, maintenance and index information of the table,
+// and the planner statistics of the requested columns.
+func Capture(ctx context.Context, db db.DB, table string, columns []string) (*Table, error) {
+	result := &Table{Name: table}
+	relation := query.QuoteIdentifier(table)
+	err := db.QueryRow(ctx, sizeStatement, relation).Scan(
+		&result.RowEstimate,
+		&result.TableSize,
+		&result.IndexesSize,
+		&result.TotalSize,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not get size of table %q", table)
+	}
+	err = db.QueryRow(ctx, fmt.Sprintf("select count(*) from %s", relation)).Scan(&result.RowCount)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not count rows of table %q", table)
+	}
+	err = db.QueryRow(ctx, maintenanceStatement, relation).Scan(
+		&result.LastVacuum,
+		&result.LastAutovacuum,
+		&result.LastAnalyze,
+		&result.LastAutoanalyze,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not get maintenance times of table %q", table)
+	}
+	if result.Indexes, err = captureIndexes(ctx, db, relation); err != nil {
+		return nil, err
+	}
+	if result.Columns, err = captureColumns(ctx, db, table, columns); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func captureIndexes(ctx context.Context, db db.DB, table string) ([]Index, error) {
+	rows, err := db.Query(ctx, indexStatement, table)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not list indexes of table %q", table)
+	}
+	defer rows.Close()
+	indexes := make([]Index, 0)
+	for rows.Next() {
+		var index Index
+		if err = rows.Scan(&index.Name, &index.Definition, &index.Size); err != nil {
+			return nil, errors.Wrapf(err, "Could not read indexes of table %q", table)
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, rows.Err()
+}
+
+func captureColumns(ctx context.Context, db db.DB, table string, columns []string) ([]Column, error) {
+	if len(columns) == 0 {
+		return nil, nil
+	}
+	columnNames := make([]string, 0, len(columns))
+	for _, column := range columns {
+		columnNames = append(columnNames, query.CatalogName(column))
+	}
+	rows, err := db.Query(ctx, columnStatement, query.CatalogName(table), columnNames)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not query column statistics of table %q", table)
+	}
+	defer rows.Close()
+	result := make([]Column, 0, len(columns))
+	for rows.Next() {
+		var column Column
+		err = rows.Scan(
+			&column.Name,
+			&column.NullFraction,
+			&column.NDistinct,
+			&column.MostCommonValues,
+			&column.MostCommonFreqs,
+			&column.Correlation,
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not read column statistics of table %q", table)
+		}
+		result = append(result, column)
+	}
+	return result, rows.Err()
+}
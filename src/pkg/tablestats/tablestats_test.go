@@ -0,0 +1,63 @@
+package tablestats
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapture(t *testing.T) {
+	analyzed := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	correlation := 0.75
+	fake := dbtest.New().
+		On("pg_total_relation_size", dbtest.Result{Rows: [][]any{{int64(990), int64(8192), int64(4096), int64(12288)}}}).
+		On("select count(*) from", dbtest.Result{Rows: [][]any{{int64(1000)}}}).
+		On("pg_stat_user_tables", dbtest.Result{Rows: [][]any{{nil, nil, &analyzed, nil}}}).
+		On("pg_get_indexdef", dbtest.Result{Rows: [][]any{
+			{"alerts_pkey", "CREATE UNIQUE INDEX alerts_pkey ON public.alerts USING btree (id)", int64(2048)},
+		}}).
+		On("from pg_stats", dbtest.Result{Rows: [][]any{
+			{"clusterid", 0.0, 3.0, []string{"c1", "c2"}, []float64{0.6, 0.3}, &correlation},
+			{"namespace", 0.1, -0.5, nil, nil, nil},
+		}})
+
+	table, err := Capture(context.Background(), fake, "Alerts", []string{"ClusterId", "Namespace"})
+	require.NoError(t, err)
+	assert.Equal(t, &Table{
+		Name:        "Alerts",
+		RowCount:    1000,
+		RowEstimate: 990,
+		TableSize:   8192,
+		IndexesSize: 4096,
+		TotalSize:   12288,
+		LastAnalyze: &analyzed,
+		Indexes: []Index{
+			{Name: "alerts_pkey", Definition: "CREATE UNIQUE INDEX alerts_pkey ON public.alerts USING btree (id)", Size: 2048},
+		},
+		Columns: []Column{
+			{Name: "clusterid", NDistinct: 3, MostCommonValues: []string{"c1", "c2"}, MostCommonFreqs: []float64{0.6, 0.3}, Correlation: &correlation},
+			{Name: "namespace", NullFraction: 0.1, NDistinct: -0.5},
+		},
+	}, table)
+
+	// The relation is rendered as an identifier, the pg_stats lookup uses
+	// the names as Postgres folds them.
+	calls := fake.Calls()
+	require.Len(t, calls, 5)
+	assert.Equal(t, []any{"Alerts"}, calls[0].Args)
+	assert.Equal(t, "select count(*) from Alerts", calls[1].SQL)
+	assert.Equal(t, []any{"alerts", []string{"clusterid", "namespace"}}, calls[4].Args)
+}
+
+func TestCaptureError(t *testing.T) {
+	failure := errors.New(`relation "alerts" does not exist`)
+	fake := dbtest.New().On("pg_total_relation_size", dbtest.Result{Err: failure})
+	_, err := Capture(context.Background(), fake, "alerts", nil)
+	assert.ErrorIs(t, err, failure)
+	assert.Len(t, fake.Calls(), 1)
+}
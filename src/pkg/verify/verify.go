@@ -0,0 +1,47 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+)
+
+// Result describes the result set of a statement by its number of rows and
+// a checksum of its rows, independent of their order.
+type Result struct {
+	Rows     int64  `json:"rows"`
+	Checksum string `json:"checksum"`
+	// Reference is the injection strategy the result set was compared
+	// with, empty when it was not compared.
+	Reference string `json:"reference,omitempty"`
+	Match     bool   `json:"match"`
+}
+
+// Statement wraps the given statement in the query computing the size and
+// checksum of its result set.
+func Statement(stmt string) string {
+	return fmt.Sprintf(
+		"select count(*), coalesce(md5(string_agg(t::text, E'\\n' order by t::text)), '') from (%s) as t",
+		stmt,
+	)
+}
+
+// Run executes the statement and returns the description of its result set.
+func Run(ctx context.Context, database db.DB, stmt string, bindValues ...interface{}) (*Result, error) {
+	result := &Result{}
+	err := database.QueryRow(ctx, Statement(stmt), bindValues...).Scan(&result.Rows, &result.Checksum)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not compute result set checksum")
+	}
+	return result, nil
+}
+
+// Compare records the comparison of the result set with the one of the
+// reference strategy, and tells whether they are the same.
+func (r *Result) Compare(reference string, referenceResult *Result) bool {
+	r.Reference = reference
+	r.Match = r.Rows == referenceResult.Rows && r.Checksum == referenceResult.Checksum
+	return r.Match
+}
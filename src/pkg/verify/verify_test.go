@@ -0,0 +1,53 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	fake := dbtest.New().On("md5", dbtest.Result{Rows: [][]any{{int64(3), "0cc175b9c0f1b6a831c399e269772661"}}})
+	result, err := Run(context.Background(), fake, "select id from alerts where alerts.State = $1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Rows: 3, Checksum: "0cc175b9c0f1b6a831c399e269772661"}, result)
+
+	calls := fake.Calls()
+	require.Len(t, calls, 1)
+	assert.Equal(
+		t,
+		"select count(*), coalesce(md5(string_agg(t::text, E'\\n' order by t::text)), '') from (select id from alerts where alerts.State = $1) as t",
+		calls[0].SQL,
+	)
+	assert.Equal(t, []any{0}, calls[0].Args)
+}
+
+func TestCompare(t *testing.T) {
+	reference := &Result{Rows: 3, Checksum: "a"}
+	for name, tc := range map[string]struct {
+		result *Result
+		match  bool
+	}{
+		"same":            {result: &Result{Rows: 3, Checksum: "a"}, match: true},
+		"duplicated rows": {result: &Result{Rows: 5, Checksum: "b"}, match: false},
+		"different rows":  {result: &Result{Rows: 3, Checksum: "b"}, match: false},
+		"missing rows":    {result: &Result{Rows: 2, Checksum: "a"}, match: false},
+	} {
+		t.Run(name, func(it *testing.T) {
+			assert.Equal(it, tc.match, tc.result.Compare("or-tree", reference))
+			assert.Equal(it, "or-tree", tc.result.Reference)
+			assert.Equal(it, tc.match, tc.result.Match)
+		})
+	}
+
+	// A mismatch is written out, not dropped as a zero value.
+	mismatch := &Result{Rows: 2, Checksum: "b"}
+	mismatch.Compare("or-tree", reference)
+	encoded, err := json.Marshal(mismatch)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"rows": 2, "checksum": "b", "reference": "or-tree", "match": false}`, string(encoded))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/catalog"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/db"
+	"github.com/rhybrillou/sacsqlperf/src/pkg/subset"
+)
+
+func dump(args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	database := flags.String("database", "", "connection string of the database to dump, the Central database if empty")
+	dir := flags.String("dir", "/tmp/sacsqlperf-dump", "directory of the dump files")
+	clusters := flags.Int("clusters", 1, "number of clusters to dump, the first ones by name")
+	clusterNames := flags.String("cluster-names", "", "comma separated names of the clusters to dump, instead of the first ones")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	selection := subset.Selection{Clusters: *clusters, ClusterNames: catalog.ParseList(*clusterNames)}
+	if selection.Clusters < 1 && len(selection.ClusterNames) == 0 {
+		return errors.Errorf("invalid number of clusters %d", selection.Clusters)
+	}
+	ctx := context.Background()
+	pool, err := connect(ctx, *database)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	manifest, err := subset.Dump(ctx, pool, *dir, selection)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Dumped %d clusters of database %s to %s\n", len(manifest.Clusters), manifest.Database, *dir)
+	return nil
+}
+
+func load(args []string) error {
+	flags := flag.NewFlagSet("load", flag.ExitOnError)
+	database := flags.String("database", "", "connection string of the database to load, required so that the Central database is never overwritten")
+	dir := flags.String("dir", "/tmp/sacsqlperf-dump", "directory of the dump files")
+	reset := flags.Bool("reset", false, "drop the existing tables of the dump before loading them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *database == "" {
+		return errors.New("the -database flag is required, load does not populate the Central database")
+	}
+	ctx := context.Background()
+	pool, err := db.Connect(ctx, *database)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	manifest, err := subset.Load(ctx, pool, *dir, *reset)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Loaded %d clusters of database %s from %s\n", len(manifest.Clusters), manifest.Database, *dir)
+	return nil
+}